@@ -0,0 +1,369 @@
+// backend.go
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Chunk is one piece of a (possibly streamed) chat completion response.
+type Chunk struct {
+	Content      string
+	FinishReason string
+}
+
+// Backend abstracts over the different ways sumarai can talk to an
+// OpenAI-compatible chat model: a locally managed llamafile or llama.cpp
+// server process, a local Ollama instance, or a remote OpenAI-compatible
+// endpoint. LlamafileClient's own methods satisfy this interface via
+// llamafileBackend so existing call sites migrate with minimal churn.
+// HealthCheck doubles as the readiness probe callers use to confirm a
+// backend is up before sending it chat completions.
+type Backend interface {
+	Start(ctx context.Context) error
+	Stop() error
+	Chat(ctx context.Context, messages []Message, streaming bool) (<-chan Chunk, error)
+	HealthCheck(ctx context.Context) error
+}
+
+// selectBackend builds the Backend named by -backend (or SUMARAI_BACKEND),
+// wiring in the already-constructed *LlamafileClient for the "llamafile"
+// and "llamacpp" cases, which still need local process management.
+func selectBackend(name string, client *LlamafileClient) (Backend, error) {
+	if name == "" {
+		name = os.Getenv("SUMARAI_BACKEND")
+	}
+	if name == "" {
+		name = "llamafile"
+	}
+
+	switch name {
+	case "llamafile":
+		return &llamafileBackend{client: client}, nil
+	case "llamacpp", "llama-cpp":
+		return &llamaCppBackend{client: client}, nil
+	case "ollama":
+		host := os.Getenv("OLLAMA_HOST")
+		if host == "" {
+			host = "http://localhost:11434"
+		}
+		model := os.Getenv("OLLAMA_MODEL")
+		if model == "" {
+			model = "llama3"
+		}
+		return &ollamaBackend{baseURL: host, model: model}, nil
+	case "openai":
+		apiKey := os.Getenv("OPENAI_API_KEY")
+		if apiKey == "" {
+			return nil, fmt.Errorf("OPENAI_API_KEY must be set to use the openai backend")
+		}
+		baseURL := os.Getenv("OPENAI_BASE_URL")
+		if baseURL == "" {
+			baseURL = "https://api.openai.com"
+		}
+		model := os.Getenv("OPENAI_MODEL")
+		if model == "" {
+			model = "gpt-4o-mini"
+		}
+		return &openAIBackend{baseURL: baseURL, apiKey: apiKey, model: model}, nil
+	default:
+		return nil, fmt.Errorf("unknown backend %q (want llamafile, llamacpp (or llama-cpp), ollama, or openai)", name)
+	}
+}
+
+// llamafileBackend adapts the existing LlamafileClient process-management
+// and HTTP plumbing to the Backend interface.
+type llamafileBackend struct {
+	client *LlamafileClient
+}
+
+func (b *llamafileBackend) Start(ctx context.Context) error { return b.client.StartLlamafile(false) }
+func (b *llamafileBackend) Stop() error                     { return b.client.StopLlamafile() }
+
+func (b *llamafileBackend) HealthCheck(ctx context.Context) error {
+	scheme := b.client.scheme
+	if scheme == "" {
+		scheme = "http"
+	}
+	url := fmt.Sprintf("%s://%s:%d/v1/models", scheme, b.client.host, b.client.port)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("llamafile health check failed with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func (b *llamafileBackend) Chat(ctx context.Context, messages []Message, streaming bool) (<-chan Chunk, error) {
+	resp, err := b.client.ChatCompletion(messages, streaming)
+	if err != nil {
+		return nil, err
+	}
+	if streaming {
+		return streamSSEChunks(resp.Body), nil
+	}
+	return singleChunkFromResponse(resp.Body)
+}
+
+// llamaCppBackend talks to a plain llama.cpp server binary, which speaks
+// the same OpenAI-compatible /v1/chat/completions API and accepts the
+// same --api-key flag as llamafile, so it delegates to llamafileBackend
+// for everything; the separate type only exists to give users a backend
+// name that matches the binary they're actually running.
+type llamaCppBackend struct {
+	client *LlamafileClient
+}
+
+func (b *llamaCppBackend) Start(ctx context.Context) error { return b.client.StartLlamafile(false) }
+func (b *llamaCppBackend) Stop() error                     { return b.client.StopLlamafile() }
+func (b *llamaCppBackend) HealthCheck(ctx context.Context) error {
+	return (&llamafileBackend{client: b.client}).HealthCheck(ctx)
+}
+func (b *llamaCppBackend) Chat(ctx context.Context, messages []Message, streaming bool) (<-chan Chunk, error) {
+	return (&llamafileBackend{client: b.client}).Chat(ctx, messages, streaming)
+}
+
+// ollamaBackend drives a local Ollama instance via its native /api/chat
+// endpoint (not Ollama's own OpenAI-compatibility shim), translating
+// sumarai's Message/Chunk types on the way in and out. It manages no local
+// process: Ollama is expected to already be running.
+type ollamaBackend struct {
+	baseURL string
+	model   string
+}
+
+func (b *ollamaBackend) Start(ctx context.Context) error { return nil }
+func (b *ollamaBackend) Stop() error                     { return nil }
+
+func (b *ollamaBackend) HealthCheck(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", b.baseURL+"/api/tags", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("ollama health check failed with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+type ollamaChatRequest struct {
+	Model    string    `json:"model"`
+	Messages []Message `json:"messages"`
+	Stream   bool      `json:"stream"`
+}
+
+type ollamaChatResponse struct {
+	Message struct {
+		Content string `json:"content"`
+	} `json:"message"`
+	Done       bool   `json:"done"`
+	DoneReason string `json:"done_reason"`
+}
+
+func (b *ollamaBackend) Chat(ctx context.Context, messages []Message, streaming bool) (<-chan Chunk, error) {
+	body, err := json.Marshal(ollamaChatRequest{Model: b.model, Messages: messages, Stream: streaming})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", b.baseURL+"/api/chat", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		data, _ := ioutil.ReadAll(resp.Body)
+		return nil, fmt.Errorf("ollama chat request failed: %d %s", resp.StatusCode, string(data))
+	}
+
+	ch := make(chan Chunk)
+	go func() {
+		defer close(ch)
+		defer resp.Body.Close()
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" {
+				continue
+			}
+			var r ollamaChatResponse
+			if err := json.Unmarshal([]byte(line), &r); err != nil {
+				continue
+			}
+			finish := ""
+			if r.Done {
+				finish = r.DoneReason
+				if finish == "" {
+					finish = "stop"
+				}
+			}
+			ch <- Chunk{Content: r.Message.Content, FinishReason: finish}
+		}
+	}()
+
+	return ch, nil
+}
+
+// openAIBackend talks to any remote OpenAI-compatible endpoint (OpenAI
+// itself, or a compatible gateway) using an API key and base URL, with no
+// local process to manage.
+type openAIBackend struct {
+	baseURL string
+	apiKey  string
+	model   string
+}
+
+func (b *openAIBackend) Start(ctx context.Context) error { return nil }
+func (b *openAIBackend) Stop() error                     { return nil }
+
+func (b *openAIBackend) HealthCheck(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", b.baseURL+"/v1/models", nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+b.apiKey)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("openai-compatible health check failed with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func (b *openAIBackend) Chat(ctx context.Context, messages []Message, streaming bool) (<-chan Chunk, error) {
+	body, err := json.Marshal(ChatCompletionRequest{Model: b.model, Messages: messages, Stream: streaming})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", b.baseURL+"/v1/chat/completions", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+b.apiKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		data, _ := ioutil.ReadAll(resp.Body)
+		return nil, fmt.Errorf("openai-compatible chat request failed: %d %s", resp.StatusCode, string(data))
+	}
+
+	if streaming {
+		return streamSSEChunks(resp.Body), nil
+	}
+	return singleChunkFromResponse(resp.Body)
+}
+
+// streamSSEChunks reads an OpenAI-style text/event-stream body and emits
+// one Chunk per data event, closing the channel (and the body) on
+// "[DONE]" or EOF. It delegates the actual parsing to sse.go's sseReader so
+// multi-line "data:" fields are joined correctly instead of being silently
+// truncated to their first line.
+func streamSSEChunks(body io.ReadCloser) <-chan Chunk {
+	ch := make(chan Chunk)
+	go func() {
+		defer close(ch)
+		defer body.Close()
+
+		sr := newSSEReader(body)
+		for event := range sr.Events {
+			data := strings.TrimSpace(event.Data)
+			if data == "[DONE]" {
+				return
+			}
+			var parsed ChatCompletionResponse
+			if jsonErr := json.Unmarshal([]byte(data), &parsed); jsonErr == nil {
+				for _, choice := range parsed.Choices {
+					ch <- Chunk{Content: CleanContent(choice.Delta.Content), FinishReason: choice.FinishReason}
+				}
+			}
+		}
+	}()
+	return ch
+}
+
+// singleChunkFromResponse decodes a non-streamed chat completion body into
+// a single Chunk delivered on a one-buffer channel.
+func singleChunkFromResponse(body io.ReadCloser) (<-chan Chunk, error) {
+	defer body.Close()
+
+	var parsed struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+			FinishReason string `json:"finish_reason"`
+		} `json:"choices"`
+		Usage *ChatCompletionUsage `json:"usage,omitempty"`
+	}
+	if err := json.NewDecoder(body).Decode(&parsed); err != nil {
+		return nil, err
+	}
+
+	if parsed.Usage != nil {
+		logger.Debug(newRequestID(), "chat completion token usage", map[string]interface{}{
+			"prompt_tokens":     parsed.Usage.PromptTokens,
+			"completion_tokens": parsed.Usage.CompletionTokens,
+			"total_tokens":      parsed.Usage.TotalTokens,
+		})
+	}
+
+	ch := make(chan Chunk, 1)
+	if len(parsed.Choices) > 0 {
+		ch <- Chunk{
+			Content:      CleanContent(parsed.Choices[0].Message.Content),
+			FinishReason: parsed.Choices[0].FinishReason,
+		}
+	}
+	close(ch)
+	return ch, nil
+}
+
+// collectChat drains a Backend's Chat channel into a single string,
+// useful for callers (like file summarization) that don't need to render
+// tokens incrementally.
+func collectChat(ctx context.Context, backend Backend, messages []Message) (string, error) {
+	ch, err := backend.Chat(ctx, messages, false)
+	if err != nil {
+		return "", err
+	}
+	var out strings.Builder
+	for chunk := range ch {
+		out.WriteString(chunk.Content)
+	}
+	return out.String(), nil
+}
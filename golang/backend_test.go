@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSelectBackendAcceptsLlamaCppAliases(t *testing.T) {
+	for _, name := range []string{"llamacpp", "llama-cpp"} {
+		backend, err := selectBackend(name, &LlamafileClient{})
+		if err != nil {
+			t.Fatalf("selectBackend(%q) returned error: %v", name, err)
+		}
+		if _, ok := backend.(*llamaCppBackend); !ok {
+			t.Errorf("selectBackend(%q) = %T, want *llamaCppBackend", name, backend)
+		}
+	}
+}
+
+func TestSelectBackendRejectsUnknownName(t *testing.T) {
+	if _, err := selectBackend("not-a-backend", &LlamafileClient{}); err == nil {
+		t.Error("expected selectBackend to reject an unknown backend name")
+	}
+}
+
+// TestLlamafileBackendHealthCheckUsesScheme is a regression test: once TLS
+// is configured, client.scheme switches to "https" and HealthCheck must
+// follow it instead of always probing plain http, which would otherwise
+// fail against an HTTPS-only listener.
+func TestLlamafileBackendHealthCheckUsesScheme(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	origTransport := http.DefaultTransport
+	http.DefaultTransport = server.Client().Transport
+	defer func() { http.DefaultTransport = origTransport }()
+
+	addr, err := net.ResolveTCPAddr("tcp", server.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("failed to resolve test server address: %v", err)
+	}
+	client := &LlamafileClient{host: addr.IP.String(), port: addr.Port, scheme: "https"}
+	backend := &llamafileBackend{client: client}
+
+	if err := backend.HealthCheck(context.Background()); err != nil {
+		t.Errorf("HealthCheck over https returned error: %v", err)
+	}
+}
+
+// TestStreamSSEChunksJoinsMultiLineData exercises streamSSEChunks against a
+// single data event whose JSON body is split across two "data:" lines,
+// which a naive parser that only looks at the first "data:" line per event
+// would hand to json.Unmarshal as truncated, invalid JSON.
+func TestStreamSSEChunksJoinsMultiLineData(t *testing.T) {
+	body := io.NopCloser(strings.NewReader(
+		"data: {\"choices\":[{\"delta\":{\"content\":\"hello\"},\"finish_reason\":null}\n" +
+			"data: ]}\n\n" +
+			"data: [DONE]\n\n",
+	))
+
+	ch := streamSSEChunks(body)
+
+	var got []Chunk
+	for chunk := range ch {
+		got = append(got, chunk)
+	}
+
+	if len(got) != 1 {
+		t.Fatalf("got %d chunks, want 1: %+v", len(got), got)
+	}
+	if got[0].Content != "hello" {
+		t.Errorf("chunk content = %q, want %q", got[0].Content, "hello")
+	}
+}
@@ -0,0 +1,301 @@
+// ctl.go
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const ctlSocketName = "sumarai.ctl"
+
+// ctlRequest is a single newline-delimited JSON command sent to the
+// running daemon's control socket.
+type ctlRequest struct {
+	Verb string   `json:"verb"`
+	Args []string `json:"args,omitempty"`
+}
+
+// ctlResponse is the daemon's newline-delimited JSON reply to a ctlRequest.
+type ctlResponse struct {
+	OK    bool   `json:"ok"`
+	Data  string `json:"data,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+func ctlSocketPath() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(homeDir, llamafileDir, ctlSocketName), nil
+}
+
+// ctlHandler implements a single control-socket verb. req.Args are the
+// words after the verb; the returned string becomes the response's Data.
+type ctlHandler func(client *LlamafileClient, req ctlRequest) (string, error)
+
+// serveCtl listens on the control socket and dispatches incoming requests
+// to the verb handler map until the listener is closed (e.g. on shutdown).
+// It runs for the lifetime of the daemon, so callers should invoke it in
+// its own goroutine.
+func (client *LlamafileClient) serveCtl() error {
+	path, err := ctlSocketPath()
+	if err != nil {
+		return err
+	}
+	os.Remove(path) // clear a stale socket from a previous, uncleanly-stopped daemon
+
+	// Go's "unix" network works for both POSIX domain sockets and, on
+	// Windows 10+, AF_UNIX sockets, so a single listener call covers the
+	// pipe-like local IPC this verb protocol needs on every platform we
+	// daemonize on.
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return fmt.Errorf("ctl: failed to listen on %s: %w", path, err)
+	}
+	// The umask-derived default mode can leave this group/world-accessible,
+	// letting any other local user issue "stop", spend the backend's tokens
+	// via "chat", or read log history via "tail-log". Restrict it to the
+	// owner.
+	if err := os.Chmod(path, 0700); err != nil {
+		listener.Close()
+		return fmt.Errorf("ctl: failed to chmod %s: %w", path, err)
+	}
+	client.ctlListener = listener
+	defer os.Remove(path)
+
+	logger.Info("", "ctl socket listening", map[string]interface{}{"path": path})
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+		go client.handleCtlConn(conn)
+	}
+}
+
+func (client *LlamafileClient) handleCtlConn(conn net.Conn) {
+	defer conn.Close()
+
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		var req ctlRequest
+		resp := ctlResponse{}
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			resp.Error = fmt.Sprintf("invalid request: %v", err)
+		} else if handler, ok := ctlHandlers[req.Verb]; ok {
+			data, err := handler(client, req)
+			if err != nil {
+				resp.Error = err.Error()
+			} else {
+				resp.OK = true
+				resp.Data = data
+			}
+		} else {
+			resp.Error = fmt.Sprintf("unknown verb %q", req.Verb)
+		}
+
+		data, err := json.Marshal(resp)
+		if err != nil {
+			return
+		}
+		if _, err := conn.Write(append(data, '\n')); err != nil {
+			return
+		}
+	}
+}
+
+var ctlHandlers = map[string]ctlHandler{
+	"status": func(client *LlamafileClient, req ctlRequest) (string, error) {
+		if client.isDraining() {
+			return "draining", nil
+		}
+		return "running", nil
+	},
+	"stop": func(client *LlamafileClient, req ctlRequest) (string, error) {
+		go func() {
+			time.Sleep(100 * time.Millisecond) // let the response flush before we tear down
+			client.StopLlamafile()
+			os.Exit(0)
+		}()
+		return "stopping", nil
+	},
+	"reload": func(client *LlamafileClient, req ctlRequest) (string, error) {
+		// The reload is handled by supervise, which listens for sighup on
+		// this (the sumarai) process rather than on the llamafile child.
+		if client.process != nil {
+			self, err := os.FindProcess(os.Getpid())
+			if err != nil {
+				return "", err
+			}
+			if err := self.Signal(sighup); err != nil {
+				return "", err
+			}
+		}
+		return "reload signaled", nil
+	},
+	"stats": func(client *LlamafileClient, req ctlRequest) (string, error) {
+		pid := -1
+		if client.process != nil {
+			pid = client.process.Pid
+		}
+		uptime := time.Duration(0)
+		if !client.startedAt.IsZero() {
+			uptime = time.Since(client.startedAt)
+		}
+		return fmt.Sprintf("pid=%d host=%s port=%d state=%s uptime=%s requests=%d tokens=%d",
+			pid, client.host, client.port, client.getState(), uptime.Round(time.Second),
+			atomic.LoadInt64(&client.requestCount), atomic.LoadInt64(&client.tokenCount)), nil
+	},
+	"state": func(client *LlamafileClient, req ctlRequest) (string, error) {
+		return string(client.getState()), nil
+	},
+	"tail-log": func(client *LlamafileClient, req ctlRequest) (string, error) {
+		data, err := readLogFile()
+		if err != nil {
+			return "", err
+		}
+		return string(data), nil
+	},
+	"tail": func(client *LlamafileClient, req ctlRequest) (string, error) {
+		n := 50
+		if len(req.Args) > 0 {
+			parsed, err := strconv.Atoi(req.Args[0])
+			if err != nil {
+				return "", fmt.Errorf("tail: invalid line count %q: %w", req.Args[0], err)
+			}
+			n = parsed
+		}
+		data, err := readLogFile()
+		if err != nil {
+			return "", err
+		}
+		return lastNLines(string(data), n), nil
+	},
+	"chat": func(client *LlamafileClient, req ctlRequest) (string, error) {
+		if len(req.Args) == 0 {
+			return "", fmt.Errorf("chat requires a prompt argument")
+		}
+		prompt := joinArgs(req.Args)
+		resp, err := client.ChatCompletion([]Message{{Role: "user", Content: prompt}}, false)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		var out ChatCompletionResponse
+		if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+			return "", err
+		}
+		if out.Usage != nil {
+			client.recordTokens(out.Usage.TotalTokens)
+		}
+		if len(out.Choices) == 0 {
+			return "", nil
+		}
+		return out.content(0), nil
+	},
+	"set-prompt": func(client *LlamafileClient, req ctlRequest) (string, error) {
+		if len(req.Args) == 0 {
+			return "", fmt.Errorf("set-prompt requires a prompt argument")
+		}
+		client.systemPrompt = joinArgs(req.Args)
+		return "prompt updated", nil
+	},
+	"list-sessions": func(client *LlamafileClient, req ctlRequest) (string, error) {
+		dir, err := sessionsDir()
+		if err != nil {
+			return "", err
+		}
+		entries, err := os.ReadDir(dir)
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		if err != nil {
+			return "", err
+		}
+		var names []string
+		for _, e := range entries {
+			names = append(names, e.Name())
+		}
+		return fmt.Sprintf("%v", names), nil
+	},
+}
+
+// readLogFile reads the daemon's log file in full; "tail" below trims it to
+// the last N lines rather than reading only a suffix of the file, since
+// sumarai's logs are small enough that this is simpler than seeking.
+func readLogFile() ([]byte, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(filepath.Join(homeDir, llamafileDir, "sumarai.log"))
+}
+
+// lastNLines returns the last n newline-terminated lines of s (fewer if s
+// has fewer than n lines).
+func lastNLines(s string, n int) string {
+	lines := strings.Split(strings.TrimRight(s, "\n"), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "\n")
+}
+
+func sessionsDir() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(homeDir, llamafileDir, "sessions"), nil
+}
+
+func joinArgs(args []string) string {
+	out := args[0]
+	for _, a := range args[1:] {
+		out += " " + a
+	}
+	return out
+}
+
+// ctlClient sends a single request to a running daemon's control socket
+// and returns its response. It returns an error if no daemon is listening.
+func ctlClient(verb string, args []string) (*ctlResponse, error) {
+	path, err := ctlSocketPath()
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := net.DialTimeout("unix", path, 2*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	data, err := json.Marshal(ctlRequest{Verb: verb, Args: args})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := conn.Write(append(data, '\n')); err != nil {
+		return nil, err
+	}
+
+	scanner := bufio.NewScanner(conn)
+	if !scanner.Scan() {
+		return nil, fmt.Errorf("ctl: no response from daemon")
+	}
+	var resp ctlResponse
+	if err := json.Unmarshal(scanner.Bytes(), &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newCtlTestClient points ctlSocketPath at a temporary $HOME so serveCtl
+// and ctlClient can round-trip over a real unix socket without touching
+// the caller's actual ~/.llamafile.
+func newCtlTestClient(t *testing.T) *LlamafileClient {
+	t.Helper()
+	home := t.TempDir()
+	origHome := os.Getenv("HOME")
+	os.Setenv("HOME", home)
+	t.Cleanup(func() { os.Setenv("HOME", origHome) })
+
+	if err := os.MkdirAll(filepath.Join(home, llamafileDir), 0700); err != nil {
+		t.Fatalf("failed to create %s: %v", llamafileDir, err)
+	}
+
+	client := &LlamafileClient{host: "localhost", port: 8080, startedAt: time.Now()}
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- client.serveCtl() }()
+	t.Cleanup(func() {
+		if client.ctlListener != nil {
+			client.ctlListener.Close()
+		}
+	})
+
+	deadline := time.Now().Add(2 * time.Second)
+	for client.ctlListener == nil {
+		select {
+		case err := <-errCh:
+			t.Fatalf("serveCtl exited before listening: %v", err)
+		default:
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("serveCtl did not start listening in time")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	return client
+}
+
+func TestCtlRoundTrip(t *testing.T) {
+	newCtlTestClient(t)
+
+	resp, err := ctlClient("status", nil)
+	if err != nil {
+		t.Fatalf("ctlClient(status) returned error: %v", err)
+	}
+	if !resp.OK || resp.Data != "running" {
+		t.Errorf("ctlClient(status) = %+v, want ok running", resp)
+	}
+
+	resp, err = ctlClient("state", nil)
+	if err != nil {
+		t.Fatalf("ctlClient(state) returned error: %v", err)
+	}
+	if !resp.OK || resp.Data != string(stateStopped) {
+		t.Errorf("ctlClient(state) = %+v, want ok %q", resp, stateStopped)
+	}
+
+	resp, err = ctlClient("stats", nil)
+	if err != nil {
+		t.Fatalf("ctlClient(stats) returned error: %v", err)
+	}
+	if !resp.OK || !strings.Contains(resp.Data, "host=localhost") || !strings.Contains(resp.Data, "port=8080") {
+		t.Errorf("ctlClient(stats) = %+v, want host/port in data", resp)
+	}
+}
+
+func TestCtlSocketIsOwnerOnly(t *testing.T) {
+	newCtlTestClient(t)
+
+	path, err := ctlSocketPath()
+	if err != nil {
+		t.Fatalf("ctlSocketPath returned error: %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("failed to stat ctl socket: %v", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0700 {
+		t.Errorf("ctl socket has mode %o, want 0700 (owner-only)", perm)
+	}
+}
+
+func TestCtlClientUnknownVerb(t *testing.T) {
+	newCtlTestClient(t)
+
+	resp, err := ctlClient("not-a-verb", nil)
+	if err != nil {
+		t.Fatalf("ctlClient(not-a-verb) returned error: %v", err)
+	}
+	if resp.OK || !strings.Contains(resp.Error, "unknown verb") {
+		t.Errorf("ctlClient(not-a-verb) = %+v, want an unknown-verb error", resp)
+	}
+}
+
+func TestCtlClientNoDaemon(t *testing.T) {
+	home := t.TempDir()
+	origHome := os.Getenv("HOME")
+	os.Setenv("HOME", home)
+	defer os.Setenv("HOME", origHome)
+
+	if err := os.MkdirAll(filepath.Join(home, llamafileDir), 0700); err != nil {
+		t.Fatalf("failed to create %s: %v", llamafileDir, err)
+	}
+
+	if _, err := ctlClient("status", nil); err == nil {
+		t.Error("expected ctlClient to fail when no daemon is listening")
+	}
+}
+
+func TestLastNLines(t *testing.T) {
+	input := "one\ntwo\nthree\nfour\nfive\n"
+
+	got := lastNLines(input, 2)
+	want := "four\nfive"
+	if got != want {
+		t.Errorf("lastNLines(_, 2) = %q, want %q", got, want)
+	}
+
+	if got := lastNLines(input, 100); got != "one\ntwo\nthree\nfour\nfive" {
+		t.Errorf("lastNLines with n greater than line count should return everything, got %q", got)
+	}
+
+	if got := lastNLines("", 5); got != "" {
+		t.Errorf("lastNLines(\"\", 5) = %q, want empty string", got)
+	}
+}
@@ -0,0 +1,75 @@
+//go:build linux
+
+// daemon_linux.go
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// daemonizedEnv marks a process as the already-detached child of daemonize,
+// so a second invocation doesn't re-exec itself forever.
+const daemonizedEnv = "SUMARAI_DAEMONIZED"
+
+// sighup is the signal the supervisor listens for to trigger a config
+// reload.
+var sighup = syscall.SIGHUP
+
+// daemonize detaches the current process from its controlling terminal and
+// parent process group. A real fork(2) is not safe once the Go runtime has
+// started extra OS threads, so this emulates the traditional double-fork by
+// re-exec'ing argv[0] as a new session leader (SysProcAttr.Setsid) with
+// SUMARAI_DAEMONIZED=1 set; the parent then exits immediately, just as the
+// first of the two forks would, leaving the child with no controlling tty
+// and no way to reacquire one. The child chdirs to "/", sets a conservative
+// umask, and redirects stdio to logFile before returning to the caller.
+func daemonize(logFile string) error {
+	if os.Getenv(daemonizedEnv) == "1" {
+		syscall.Umask(0022)
+		if err := os.Chdir("/"); err != nil {
+			return fmt.Errorf("daemonize: chdir: %w", err)
+		}
+		return redirectStdio(logFile)
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("daemonize: %w", err)
+	}
+
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Env = append(os.Environ(), daemonizedEnv+"=1")
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+
+	if devnull, err := os.OpenFile(os.DevNull, os.O_RDWR, 0); err == nil {
+		cmd.Stdin = devnull
+		cmd.Stdout = devnull
+		cmd.Stderr = devnull
+	}
+
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("daemonize: failed to re-exec as daemon: %w", err)
+	}
+
+	os.Exit(0)
+	return nil
+}
+
+func redirectStdio(logFile string) error {
+	if logFile == "" {
+		return nil
+	}
+
+	f, err := os.OpenFile(logFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("daemonize: failed to open log file: %w", err)
+	}
+
+	if err := syscall.Dup2(int(f.Fd()), int(os.Stdout.Fd())); err != nil {
+		return err
+	}
+	return syscall.Dup2(int(f.Fd()), int(os.Stderr.Fd()))
+}
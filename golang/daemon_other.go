@@ -0,0 +1,20 @@
+//go:build !linux && !windows
+
+// daemon_other.go
+package main
+
+import (
+	"syscall"
+)
+
+// sighup is the signal the supervisor listens for to trigger a config
+// reload.
+var sighup = syscall.SIGHUP
+
+// daemonize's Setsid-based re-exec trick relies on syscall.Dup2, which the
+// standard library only exposes on Linux. Other Unix-likes fall back to
+// running in the foreground rather than silently skipping detachment.
+func daemonize(logFile string) error {
+	logger.Warn("", "double-fork daemonization is only implemented on Linux; running -service in the foreground instead", nil)
+	return nil
+}
@@ -0,0 +1,20 @@
+//go:build windows
+
+// daemon_windows.go
+package main
+
+import (
+	"os"
+)
+
+// sighup has no Windows equivalent; reload-on-signal is unsupported there,
+// so this just gives the ctl handler a signal value that compiles.
+var sighup = os.Interrupt
+
+// daemonize has no Windows equivalent of fork/setsid; -service on Windows
+// falls back to running llamafile in the foreground of the current
+// process rather than failing outright.
+func daemonize(logFile string) error {
+	logger.Warn("", "daemonization is not supported on Windows; running -service in the foreground instead", nil)
+	return nil
+}
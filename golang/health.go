@@ -0,0 +1,28 @@
+// health.go
+package main
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// serveHealth runs an HTTP server exposing GET /v1/health so external
+// orchestrators (e.g. a Kubernetes readiness probe) can tell when
+// StopLlamafile has entered its lame-duck drain window and stop routing
+// new traffic before the pod is actually killed. It blocks until the
+// server stops, so callers should invoke it in its own goroutine.
+func (client *LlamafileClient) serveHealth(addr string) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/health", func(w http.ResponseWriter, r *http.Request) {
+		if client.isDraining() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprintln(w, "draining")
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintln(w, "ok")
+	})
+
+	logger.Info("", "health endpoint listening", map[string]interface{}{"addr": addr})
+	return http.ListenAndServe(addr, mux)
+}
@@ -0,0 +1,467 @@
+// logger.go
+package main
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LogLevel identifies the severity of a log event.
+type LogLevel int
+
+const (
+	LevelDebug LogLevel = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+	LevelFatal
+)
+
+func (l LogLevel) String() string {
+	switch l {
+	case LevelDebug:
+		return "DEBUG"
+	case LevelInfo:
+		return "INFO"
+	case LevelWarn:
+		return "WARN"
+	case LevelError:
+		return "ERROR"
+	case LevelFatal:
+		return "FATAL"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+func parseLogLevel(s string) (LogLevel, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "debug":
+		return LevelDebug, nil
+	case "info", "":
+		return LevelInfo, nil
+	case "warn", "warning":
+		return LevelWarn, nil
+	case "error":
+		return LevelError, nil
+	case "fatal":
+		return LevelFatal, nil
+	default:
+		return LevelInfo, fmt.Errorf("unknown log level %q", s)
+	}
+}
+
+// Logger is the structured logging interface used throughout sumarai.
+// Implementations must be safe for concurrent use.
+type Logger interface {
+	Debug(requestID, msg string, fields map[string]interface{})
+	Info(requestID, msg string, fields map[string]interface{})
+	Warn(requestID, msg string, fields map[string]interface{})
+	Error(requestID, msg string, fields map[string]interface{})
+	Fatal(requestID, msg string, fields map[string]interface{})
+	Close() error
+}
+
+// defaultLogger writes leveled events to a rotating writer in either
+// key=value text format or single-line JSON.
+type defaultLogger struct {
+	mu     sync.Mutex
+	level  LogLevel
+	format string // "text" or "json"
+	out    io.WriteCloser
+}
+
+// NewLogger builds a Logger writing at minimum severity level, encoded as
+// either "text" or "json", to logFile (rotated at rotateMB megabytes,
+// keeping keepFiles gzipped backups) or to stderr when logFile is empty.
+func NewLogger(level LogLevel, format string, logFile string, rotateMB int, keepFiles int) (Logger, error) {
+	if format != "text" && format != "json" {
+		format = "text"
+	}
+
+	var out io.WriteCloser
+	if logFile == "" {
+		out = nopCloser{os.Stderr}
+	} else {
+		rw, err := newRotatingWriter(logFile, rotateMB, keepFiles)
+		if err != nil {
+			return nil, err
+		}
+		out = rw
+	}
+
+	return &defaultLogger{level: level, format: format, out: out}, nil
+}
+
+type nopCloser struct{ io.Writer }
+
+func (nopCloser) Close() error { return nil }
+
+func (l *defaultLogger) log(level LogLevel, requestID, msg string, fields map[string]interface{}) {
+	if level < l.level {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	ts := time.Now().UTC().Format(time.RFC3339Nano)
+	if l.format == "json" {
+		fmt.Fprintln(l.out, encodeLogJSON(ts, level, requestID, msg, fields))
+	} else {
+		fmt.Fprintln(l.out, encodeLogText(ts, level, requestID, msg, fields))
+	}
+
+	if level == LevelFatal {
+		l.out.Close()
+		os.Exit(1)
+	}
+}
+
+func encodeLogText(ts string, level LogLevel, requestID, msg string, fields map[string]interface{}) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "time=%s level=%s msg=%q", ts, level, msg)
+	if requestID != "" {
+		fmt.Fprintf(&b, " request_id=%s", requestID)
+	}
+	for k, v := range fields {
+		fmt.Fprintf(&b, " %s=%v", k, v)
+	}
+	return b.String()
+}
+
+func encodeLogJSON(ts string, level LogLevel, requestID, msg string, fields map[string]interface{}) string {
+	entry := map[string]interface{}{
+		"time":  ts,
+		"level": level.String(),
+		"msg":   msg,
+	}
+	if requestID != "" {
+		entry["request_id"] = requestID
+	}
+	for k, v := range fields {
+		entry[k] = v
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Sprintf(`{"time":%q,"level":"ERROR","msg":"failed to encode log entry: %s"}`, ts, err)
+	}
+	return string(data)
+}
+
+func (l *defaultLogger) Debug(requestID, msg string, fields map[string]interface{}) {
+	l.log(LevelDebug, requestID, msg, fields)
+}
+func (l *defaultLogger) Info(requestID, msg string, fields map[string]interface{}) {
+	l.log(LevelInfo, requestID, msg, fields)
+}
+func (l *defaultLogger) Warn(requestID, msg string, fields map[string]interface{}) {
+	l.log(LevelWarn, requestID, msg, fields)
+}
+func (l *defaultLogger) Error(requestID, msg string, fields map[string]interface{}) {
+	l.log(LevelError, requestID, msg, fields)
+}
+func (l *defaultLogger) Fatal(requestID, msg string, fields map[string]interface{}) {
+	l.log(LevelFatal, requestID, msg, fields)
+}
+
+func (l *defaultLogger) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.out.Close()
+}
+
+// LogSink is one destination a multiLogger fans events out to: "human"
+// (key=value text), "json" (single-line JSON), or "stackdriver" (single-line
+// JSON using Google Cloud's severity/message/timestamp field names).
+type LogSink struct {
+	Kind string
+	Path string
+}
+
+// logSinkFlag implements flag.Value so -log can be repeated on the command
+// line, once per sink, as "<kind>=<path>".
+type logSinkFlag struct {
+	sinks *[]LogSink
+}
+
+func (f *logSinkFlag) String() string {
+	if f.sinks == nil {
+		return ""
+	}
+	parts := make([]string, len(*f.sinks))
+	for i, s := range *f.sinks {
+		parts[i] = fmt.Sprintf("%s=%s", s.Kind, s.Path)
+	}
+	return strings.Join(parts, ",")
+}
+
+func (f *logSinkFlag) Set(value string) error {
+	kind, path, ok := strings.Cut(value, "=")
+	if !ok {
+		return fmt.Errorf("log sink %q must be in <kind>=<path> form", value)
+	}
+	switch kind {
+	case "human", "json", "stackdriver":
+	default:
+		return fmt.Errorf("unknown log sink kind %q: must be human, json, or stackdriver", kind)
+	}
+	*f.sinks = append(*f.sinks, LogSink{Kind: kind, Path: path})
+	return nil
+}
+
+// stackdriverSeverity maps sumarai's log levels onto the severity strings
+// Google Cloud's logging agent expects in a structured JSON payload.
+func stackdriverSeverity(level LogLevel) string {
+	switch level {
+	case LevelDebug:
+		return "DEBUG"
+	case LevelInfo:
+		return "INFO"
+	case LevelWarn:
+		return "WARNING"
+	case LevelError:
+		return "ERROR"
+	case LevelFatal:
+		return "CRITICAL"
+	default:
+		return "DEFAULT"
+	}
+}
+
+func encodeLogStackdriver(ts string, level LogLevel, requestID, msg string, fields map[string]interface{}) string {
+	entry := map[string]interface{}{
+		"severity":  stackdriverSeverity(level),
+		"message":   msg,
+		"timestamp": ts,
+	}
+	if requestID != "" {
+		entry["request_id"] = requestID
+	}
+	for k, v := range fields {
+		entry[k] = v
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Sprintf(`{"severity":"ERROR","message":"failed to encode log entry: %s","timestamp":%q}`, err, ts)
+	}
+	return string(data)
+}
+
+// sinkWriter serializes one sink's writes behind its own mutex so that
+// concurrent log calls never interleave partial lines, independent of any
+// other sink.
+type sinkWriter struct {
+	mu   sync.Mutex
+	kind string
+	out  io.WriteCloser
+}
+
+func (w *sinkWriter) write(ts string, level LogLevel, requestID, msg string, fields map[string]interface{}) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	switch w.kind {
+	case "json":
+		fmt.Fprintln(w.out, encodeLogJSON(ts, level, requestID, msg, fields))
+	case "stackdriver":
+		fmt.Fprintln(w.out, encodeLogStackdriver(ts, level, requestID, msg, fields))
+	default:
+		fmt.Fprintln(w.out, encodeLogText(ts, level, requestID, msg, fields))
+	}
+}
+
+func (w *sinkWriter) Close() error {
+	return w.out.Close()
+}
+
+// multiLogger fans every log event out to one or more sinkWriters, each
+// with its own encoding and its own mutex, so (for example) a human-
+// readable file and a Stackdriver-formatted file can both be kept current
+// from the same process without one sink's formatting leaking into
+// another's.
+type multiLogger struct {
+	level LogLevel
+	sinks []*sinkWriter
+}
+
+// NewMultiLogger builds a Logger that writes every event, at minimum
+// severity level, to each of sinks.
+func NewMultiLogger(level LogLevel, sinks []LogSink) (Logger, error) {
+	writers := make([]*sinkWriter, 0, len(sinks))
+	for _, s := range sinks {
+		var out io.WriteCloser
+		if s.Path == "" || s.Path == "-" {
+			out = nopCloser{os.Stderr}
+		} else {
+			rw, err := newRotatingWriter(s.Path, 10, 3)
+			if err != nil {
+				return nil, err
+			}
+			out = rw
+		}
+		writers = append(writers, &sinkWriter{kind: s.Kind, out: out})
+	}
+	return &multiLogger{level: level, sinks: writers}, nil
+}
+
+func (l *multiLogger) log(level LogLevel, requestID, msg string, fields map[string]interface{}) {
+	if level < l.level {
+		return
+	}
+
+	ts := time.Now().UTC().Format(time.RFC3339Nano)
+	for _, w := range l.sinks {
+		w.write(ts, level, requestID, msg, fields)
+	}
+
+	if level == LevelFatal {
+		l.Close()
+		os.Exit(1)
+	}
+}
+
+func (l *multiLogger) Debug(requestID, msg string, fields map[string]interface{}) {
+	l.log(LevelDebug, requestID, msg, fields)
+}
+func (l *multiLogger) Info(requestID, msg string, fields map[string]interface{}) {
+	l.log(LevelInfo, requestID, msg, fields)
+}
+func (l *multiLogger) Warn(requestID, msg string, fields map[string]interface{}) {
+	l.log(LevelWarn, requestID, msg, fields)
+}
+func (l *multiLogger) Error(requestID, msg string, fields map[string]interface{}) {
+	l.log(LevelError, requestID, msg, fields)
+}
+func (l *multiLogger) Fatal(requestID, msg string, fields map[string]interface{}) {
+	l.log(LevelFatal, requestID, msg, fields)
+}
+
+func (l *multiLogger) Close() error {
+	var firstErr error
+	for _, w := range l.sinks {
+		if err := w.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// rotatingWriter is an io.WriteCloser that rotates the underlying file once
+// it exceeds rotateMB megabytes, gzipping up to keepFiles old generations.
+type rotatingWriter struct {
+	mu        sync.Mutex
+	path      string
+	rotateMax int64
+	keep      int
+	size      int64
+	file      *os.File
+}
+
+func newRotatingWriter(path string, rotateMB int, keep int) (*rotatingWriter, error) {
+	if rotateMB <= 0 {
+		rotateMB = 50
+	}
+	if keep < 0 {
+		keep = 0
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return &rotatingWriter{
+		path:      path,
+		rotateMax: int64(rotateMB) * 1024 * 1024,
+		keep:      keep,
+		size:      info.Size(),
+		file:      f,
+	}, nil
+}
+
+func (w *rotatingWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.size+int64(len(p)) > w.rotateMax {
+		if err := w.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+func (w *rotatingWriter) rotate() error {
+	if err := w.file.Close(); err != nil {
+		return err
+	}
+
+	for i := w.keep; i >= 1; i-- {
+		src := fmt.Sprintf("%s.%d.gz", w.path, i)
+		dst := fmt.Sprintf("%s.%d.gz", w.path, i+1)
+		if i == w.keep {
+			os.Remove(src)
+			continue
+		}
+		os.Rename(src, dst)
+	}
+
+	if w.keep > 0 {
+		if err := gzipFile(w.path, fmt.Sprintf("%s.1.gz", w.path)); err != nil {
+			return err
+		}
+	}
+
+	f, err := os.OpenFile(w.path, os.O_TRUNC|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	w.file = f
+	w.size = 0
+	return nil
+}
+
+func gzipFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	gw := gzip.NewWriter(out)
+	defer gw.Close()
+
+	_, err = io.Copy(gw, in)
+	return err
+}
+
+func (w *rotatingWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.file.Close()
+}
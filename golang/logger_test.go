@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNewMultiLoggerWritesEachSink(t *testing.T) {
+	dir := t.TempDir()
+	jsonPath := filepath.Join(dir, "events.json")
+	sdPath := filepath.Join(dir, "events.stackdriver.json")
+
+	l, err := NewMultiLogger(LevelInfo, []LogSink{
+		{Kind: "json", Path: jsonPath},
+		{Kind: "stackdriver", Path: sdPath},
+	})
+	if err != nil {
+		t.Fatalf("NewMultiLogger failed: %v", err)
+	}
+
+	l.Info("req-1", "chat completion request succeeded", map[string]interface{}{"latency_ms": 42, "model": "local-model"})
+	l.Close()
+
+	jsonData, err := os.ReadFile(jsonPath)
+	if err != nil {
+		t.Fatalf("failed to read json sink: %v", err)
+	}
+	var jsonEntry map[string]interface{}
+	if err := json.Unmarshal(jsonData[:len(jsonData)-1], &jsonEntry); err != nil {
+		t.Fatalf("json sink did not produce valid JSON: %v", err)
+	}
+	if jsonEntry["request_id"] != "req-1" || jsonEntry["level"] != "INFO" || jsonEntry["latency_ms"] != float64(42) {
+		t.Errorf("unexpected json sink entry: %v", jsonEntry)
+	}
+
+	sdData, err := os.ReadFile(sdPath)
+	if err != nil {
+		t.Fatalf("failed to read stackdriver sink: %v", err)
+	}
+	var sdEntry map[string]interface{}
+	if err := json.Unmarshal(sdData[:len(sdData)-1], &sdEntry); err != nil {
+		t.Fatalf("stackdriver sink did not produce valid JSON: %v", err)
+	}
+	if sdEntry["severity"] != "INFO" || sdEntry["message"] != "chat completion request succeeded" {
+		t.Errorf("unexpected stackdriver sink entry: %v", sdEntry)
+	}
+}
+
+func TestLogSinkFlagRejectsUnknownKind(t *testing.T) {
+	var sinks []LogSink
+	f := &logSinkFlag{sinks: &sinks}
+
+	if err := f.Set("human=/tmp/sumarai-human.log"); err != nil {
+		t.Errorf("expected human sink to be accepted, got %v", err)
+	}
+	if err := f.Set("carbon-paper=/tmp/whatever.log"); err == nil {
+		t.Error("expected unknown sink kind to be rejected")
+	}
+	if len(sinks) != 1 {
+		t.Errorf("expected 1 sink registered, got %d", len(sinks))
+	}
+}
@@ -0,0 +1,301 @@
+// remote.go
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// remoteSession tracks an SSH connection used to run llamafile on another
+// host: remotePort is the port llamafile is told to bind to on the far
+// end (client.port is overwritten with the local forwarded port once the
+// tunnel is up, so it can no longer be used for this), the PID of the
+// remote llamafile process so StopLlamafile can kill it, and the tunnel's
+// listener so it can be torn down cleanly.
+type remoteSession struct {
+	client     *ssh.Client
+	listener   net.Listener
+	remotePID  int
+	remotePort int
+}
+
+// configureRemote parses a "user@host[:port]" spec, dials it over SSH using
+// key/agent/known-hosts auth (never shelling out to the system ssh binary
+// so auth is handled programmatically), verifies or uploads the llamafile
+// binary, and arranges for client.host/client.port to keep pointing at
+// localhost:<forwarded port> so the rest of sumarai is unaware the server
+// is remote.
+func (client *LlamafileClient) configureRemote(remoteSpec string, upload bool) error {
+	user, host, port, err := parseRemoteSpec(remoteSpec)
+	if err != nil {
+		return err
+	}
+
+	sshConfig, err := buildSSHClientConfig(user)
+	if err != nil {
+		return err
+	}
+
+	sshClient, err := ssh.Dial("tcp", net.JoinHostPort(host, port), sshConfig)
+	if err != nil {
+		return fmt.Errorf("remote: failed to connect to %s: %w", remoteSpec, err)
+	}
+
+	remotePath, err := verifyOrUploadRemoteExecutable(sshClient, client.executablePath, upload)
+	if err != nil {
+		sshClient.Close()
+		return err
+	}
+	client.executablePath = remotePath
+
+	remotePort := client.port
+	localPort, listener, err := forwardLocalPort(sshClient, remotePort)
+	if err != nil {
+		sshClient.Close()
+		return err
+	}
+
+	client.remoteSession = &remoteSession{client: sshClient, listener: listener, remotePort: remotePort}
+	client.host = defaultHost
+	client.port = localPort
+	client.remoteSpec = remoteSpec
+	logger.Info("", "configured remote llamafile execution", map[string]interface{}{"remote": remoteSpec, "local_port": localPort})
+	return nil
+}
+
+// parseRemoteSpec splits "user@host[:port]" into its components, defaulting
+// to port 22 when unspecified.
+func parseRemoteSpec(spec string) (user, host, port string, err error) {
+	at := strings.Index(spec, "@")
+	if at < 0 {
+		return "", "", "", fmt.Errorf("remote: %q is not in user@host[:port] form", spec)
+	}
+	user = spec[:at]
+	hostport := spec[at+1:]
+
+	if strings.Contains(hostport, ":") {
+		host, port, err = net.SplitHostPort(hostport)
+		if err != nil {
+			return "", "", "", fmt.Errorf("remote: invalid host:port %q: %w", hostport, err)
+		}
+		return user, host, port, nil
+	}
+	return user, hostport, "22", nil
+}
+
+// buildSSHClientConfig assembles auth methods from the running SSH agent
+// (if any) and the user's default private keys, and verifies the server
+// against ~/.ssh/known_hosts rather than skipping host key checking.
+func buildSSHClientConfig(user string) (*ssh.ClientConfig, error) {
+	var authMethods []ssh.AuthMethod
+
+	if sock := os.Getenv("SSH_AUTH_SOCK"); sock != "" {
+		if conn, err := net.Dial("unix", sock); err == nil {
+			authMethods = append(authMethods, ssh.PublicKeysCallback(agent.NewClient(conn).Signers))
+		}
+	}
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range []string{"id_ed25519", "id_rsa"} {
+		keyPath := homeDir + "/.ssh/" + name
+		if key, err := os.ReadFile(keyPath); err == nil {
+			if signer, err := ssh.ParsePrivateKey(key); err == nil {
+				authMethods = append(authMethods, ssh.PublicKeys(signer))
+			}
+		}
+	}
+
+	if len(authMethods) == 0 {
+		return nil, fmt.Errorf("remote: no usable SSH auth method found (no agent, no unencrypted key in ~/.ssh)")
+	}
+
+	hostKeyCallback, err := knownhosts.New(homeDir + "/.ssh/known_hosts")
+	if err != nil {
+		return nil, fmt.Errorf("remote: failed to load known_hosts: %w", err)
+	}
+
+	return &ssh.ClientConfig{
+		User:            user,
+		Auth:            authMethods,
+		HostKeyCallback: hostKeyCallback,
+	}, nil
+}
+
+// verifyOrUploadRemoteExecutable checks that the remote host's $LLAMAFILE
+// (or $HOME/llamafile when $LLAMAFILE is unset) exists and is executable,
+// uploading the local binary at localPath to $HOME/llamafile by piping it
+// through "cat" over an SSH session when upload is set and it is missing.
+// It returns the path to use on the remote side.
+func verifyOrUploadRemoteExecutable(sshClient *ssh.Client, localPath string, upload bool) (string, error) {
+	session, err := sshClient.NewSession()
+	if err != nil {
+		return "", err
+	}
+	defer session.Close()
+
+	remotePath := "$LLAMAFILE"
+	checkCmd := `test -x "${LLAMAFILE:-$HOME/llamafile}" && echo "${LLAMAFILE:-$HOME/llamafile}"`
+	out, err := session.CombinedOutput(checkCmd)
+	if err == nil {
+		return strings.TrimSpace(string(out)), nil
+	}
+
+	if !upload {
+		return "", fmt.Errorf("remote: llamafile not found on remote host and -upload not set")
+	}
+	if localPath == "" {
+		return "", fmt.Errorf("remote: -upload requires a local llamafile executable to upload")
+	}
+
+	data, err := os.ReadFile(localPath)
+	if err != nil {
+		return "", fmt.Errorf("remote: failed to read local executable for upload: %w", err)
+	}
+
+	uploadSession, err := sshClient.NewSession()
+	if err != nil {
+		return "", err
+	}
+	defer uploadSession.Close()
+
+	remotePath = "$HOME/llamafile"
+	stdin, err := uploadSession.StdinPipe()
+	if err != nil {
+		return "", err
+	}
+	if err := uploadSession.Start(fmt.Sprintf(`cat > "%s" && chmod +x "%s"`, remotePath, remotePath)); err != nil {
+		return "", err
+	}
+	if _, err := stdin.Write(data); err != nil {
+		return "", err
+	}
+	stdin.Close()
+	if err := uploadSession.Wait(); err != nil {
+		return "", fmt.Errorf("remote: upload failed: %w", err)
+	}
+
+	return remotePath, nil
+}
+
+// forwardLocalPort opens a local listener on an ephemeral port and pipes
+// every connection accepted on it through the SSH connection to
+// localhost:remotePort on the far end, so the existing ChatCompletion code
+// keeps dialing plain localhost:<port> regardless of where llamafile is
+// actually running.
+func forwardLocalPort(sshClient *ssh.Client, remotePort int) (int, net.Listener, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, nil, err
+	}
+
+	localPort := listener.Addr().(*net.TCPAddr).Port
+	remoteAddr := net.JoinHostPort("localhost", strconv.Itoa(remotePort))
+
+	go func() {
+		for {
+			localConn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go proxyTunnelConn(sshClient, localConn, remoteAddr)
+		}
+	}()
+
+	return localPort, listener, nil
+}
+
+func proxyTunnelConn(sshClient *ssh.Client, localConn net.Conn, remoteAddr string) {
+	defer localConn.Close()
+
+	remoteConn, err := sshClient.Dial("tcp", remoteAddr)
+	if err != nil {
+		logger.Error("", "remote: failed to dial forwarded port", map[string]interface{}{"error": err.Error()})
+		return
+	}
+	defer remoteConn.Close()
+
+	done := make(chan struct{}, 2)
+	go func() { copyAndSignal(remoteConn, localConn, done) }()
+	go func() { copyAndSignal(localConn, remoteConn, done) }()
+	<-done
+}
+
+func copyAndSignal(dst, src net.Conn, done chan<- struct{}) {
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := src.Read(buf)
+		if n > 0 {
+			if _, werr := dst.Write(buf[:n]); werr != nil {
+				break
+			}
+		}
+		if err != nil {
+			break
+		}
+	}
+	done <- struct{}{}
+}
+
+// startRemote launches llamafile on the configured remote host over the
+// existing SSH connection, capturing its PID so stopRemote can kill it
+// later. If the launch fails, the SSH connection and tunnel are left in
+// place; stopRemote is what tears them down.
+func (client *LlamafileClient) startRemote() error {
+	session, err := client.remoteSession.client.NewSession()
+	if err != nil {
+		return err
+	}
+
+	args := fmt.Sprintf("--api-key %s", client.apiKey)
+	cmd := fmt.Sprintf(`nohup %s %s --port %d >/dev/null 2>&1 & echo $!`, client.executablePath, args, client.remoteSession.remotePort)
+
+	out, err := session.CombinedOutput(cmd)
+	session.Close()
+	if err != nil {
+		return fmt.Errorf("remote: failed to start llamafile: %w", err)
+	}
+
+	pid, err := strconv.Atoi(strings.TrimSpace(string(out)))
+	if err != nil {
+		return fmt.Errorf("remote: could not parse remote PID from %q: %w", strings.TrimSpace(string(out)), err)
+	}
+	client.remoteSession.remotePID = pid
+	logger.Info("", "started remote llamafile", map[string]interface{}{"remote": client.remoteSpec, "pid": pid})
+
+	return client.waitForServer()
+}
+
+// stopRemote kills the remote llamafile process and tears down the SSH
+// tunnel and connection.
+func (client *LlamafileClient) stopRemote() error {
+	rs := client.remoteSession
+	if rs == nil {
+		return nil
+	}
+
+	if rs.remotePID != 0 {
+		session, err := rs.client.NewSession()
+		if err == nil {
+			session.CombinedOutput(fmt.Sprintf("kill %d", rs.remotePID))
+			session.Close()
+		}
+	}
+
+	if rs.listener != nil {
+		rs.listener.Close()
+	}
+	err := rs.client.Close()
+	client.remoteSession = nil
+	logger.Info("", "stopped remote llamafile and tore down tunnel", map[string]interface{}{"remote": client.remoteSpec})
+	return err
+}
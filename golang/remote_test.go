@@ -0,0 +1,246 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// directTcpipChannelData mirrors the RFC 4254 7.2 "direct-tcpip" channel
+// open payload, so the test SSH server can see which host:port the
+// tunnel is asking to reach.
+type directTcpipChannelData struct {
+	Addr       string
+	Port       uint32
+	OriginAddr string
+	OriginPort uint32
+}
+
+// execRequest mirrors the RFC 4254 6.5 "exec" channel request payload.
+type execRequest struct {
+	Command string
+}
+
+// newTestSSHServer starts an in-process SSH server on 127.0.0.1 and
+// returns a client already connected to it. execHandler answers "session"
+// channels' exec requests with (output, exit status); dialAddr is called
+// for each "direct-tcpip" channel to obtain the connection it tunnels to.
+func newTestSSHServer(t *testing.T, execHandler func(cmd string) (string, uint32), dialAddr func(addr string, port uint32) (net.Conn, error)) *ssh.Client {
+	t.Helper()
+
+	hostKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate host key: %v", err)
+	}
+	signer, err := ssh.NewSignerFromKey(hostKey)
+	if err != nil {
+		t.Fatalf("failed to build host key signer: %v", err)
+	}
+
+	config := &ssh.ServerConfig{NoClientAuth: true}
+	config.AddHostKey(signer)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen for test SSH server: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveTestSSHConn(t, conn, config, execHandler, dialAddr)
+		}
+	}()
+
+	client, err := ssh.Dial("tcp", listener.Addr().String(), &ssh.ClientConfig{
+		User:            "test",
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		Timeout:         2 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("failed to dial test SSH server: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+
+	return client
+}
+
+func serveTestSSHConn(t *testing.T, conn net.Conn, config *ssh.ServerConfig, execHandler func(cmd string) (string, uint32), dialAddr func(addr string, port uint32) (net.Conn, error)) {
+	sConn, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	defer sConn.Close()
+	go ssh.DiscardRequests(reqs)
+
+	for newChannel := range chans {
+		switch newChannel.ChannelType() {
+		case "session":
+			go serveTestSession(newChannel, execHandler)
+		case "direct-tcpip":
+			go serveTestDirectTCPIP(newChannel, dialAddr)
+		default:
+			newChannel.Reject(ssh.UnknownChannelType, "unsupported channel type")
+		}
+	}
+}
+
+func serveTestSession(newChannel ssh.NewChannel, execHandler func(cmd string) (string, uint32)) {
+	channel, requests, err := newChannel.Accept()
+	if err != nil {
+		return
+	}
+	defer channel.Close()
+
+	for req := range requests {
+		if req.Type != "exec" {
+			req.Reply(false, nil)
+			continue
+		}
+		var payload execRequest
+		if err := ssh.Unmarshal(req.Payload, &payload); err != nil {
+			req.Reply(false, nil)
+			continue
+		}
+		req.Reply(true, nil)
+
+		output, exitStatus := execHandler(payload.Command)
+		io.WriteString(channel, output)
+		channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{exitStatus}))
+		return
+	}
+}
+
+func serveTestDirectTCPIP(newChannel ssh.NewChannel, dialAddr func(addr string, port uint32) (net.Conn, error)) {
+	var data directTcpipChannelData
+	if err := ssh.Unmarshal(newChannel.ExtraData(), &data); err != nil {
+		newChannel.Reject(ssh.ConnectionFailed, "malformed direct-tcpip request")
+		return
+	}
+
+	target, err := dialAddr(data.Addr, data.Port)
+	if err != nil {
+		newChannel.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+	defer target.Close()
+
+	channel, requests, err := newChannel.Accept()
+	if err != nil {
+		return
+	}
+	defer channel.Close()
+	go ssh.DiscardRequests(requests)
+
+	done := make(chan struct{}, 2)
+	go func() { io.Copy(target, channel); done <- struct{}{} }()
+	go func() { io.Copy(channel, target); done <- struct{}{} }()
+	<-done
+}
+
+// TestForwardLocalPortProxiesTraffic exercises the tunnel's data plane end
+// to end against a real in-process SSH server: a local listener stands in
+// for a remote llamafile, forwardLocalPort opens the tunnel to it, and
+// data written on the local forwarded port must come back out the other
+// side unchanged.
+func TestForwardLocalPortProxiesTraffic(t *testing.T) {
+	remoteEcho, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to start stand-in remote listener: %v", err)
+	}
+	defer remoteEcho.Close()
+	remotePort := remoteEcho.Addr().(*net.TCPAddr).Port
+
+	go func() {
+		for {
+			conn, err := remoteEcho.Accept()
+			if err != nil {
+				return
+			}
+			go func(c net.Conn) {
+				defer c.Close()
+				io.Copy(c, c) // echo whatever it receives
+			}(conn)
+		}
+	}()
+
+	sshClient := newTestSSHServer(t, nil, func(addr string, port uint32) (net.Conn, error) {
+		return net.Dial("tcp", fmt.Sprintf("%s:%d", addr, port))
+	})
+
+	localPort, listener, err := forwardLocalPort(sshClient, remotePort)
+	if err != nil {
+		t.Fatalf("forwardLocalPort returned error: %v", err)
+	}
+	defer listener.Close()
+
+	conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", localPort))
+	if err != nil {
+		t.Fatalf("failed to dial forwarded local port: %v", err)
+	}
+	defer conn.Close()
+
+	const message = "hello through the tunnel"
+	if _, err := conn.Write([]byte(message)); err != nil {
+		t.Fatalf("failed to write through the tunnel: %v", err)
+	}
+
+	buf := make([]byte, len(message))
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		t.Fatalf("failed to read echoed data back through the tunnel: %v", err)
+	}
+	if string(buf) != message {
+		t.Errorf("got %q back through the tunnel, want %q", string(buf), message)
+	}
+}
+
+// TestStartRemoteUsesRemoteSessionPort is a regression test for the
+// configureRemote/startRemote port mix-up: it pins remoteSession.remotePort
+// to a value different from client.port and asserts the command sent over
+// the session references the former, not the latter.
+func TestStartRemoteUsesRemoteSessionPort(t *testing.T) {
+	var gotCmd string
+	sshClient := newTestSSHServer(t, func(cmd string) (string, uint32) {
+		gotCmd = cmd
+		return "12345\n", 0
+	}, nil)
+
+	remoteListener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to open stand-in local forwarded port: %v", err)
+	}
+	defer remoteListener.Close()
+	localPort := remoteListener.Addr().(*net.TCPAddr).Port
+
+	client := &LlamafileClient{
+		host:           defaultHost,
+		port:           localPort, // the local forwarded port, as configureRemote leaves it
+		executablePath: "/opt/llamafile",
+		apiKey:         "testkey",
+		remoteSpec:     "user@remotehost",
+		remoteSession:  &remoteSession{client: sshClient, remotePort: 9999},
+	}
+
+	if err := client.startRemote(); err != nil {
+		t.Fatalf("startRemote returned error: %v", err)
+	}
+
+	if !strings.Contains(gotCmd, "--port 9999") {
+		t.Errorf("startRemote's command = %q, want it to reference the remote port 9999, not client.port (%d)", gotCmd, localPort)
+	}
+	if strings.Contains(gotCmd, fmt.Sprintf("--port %d", localPort)) {
+		t.Errorf("startRemote's command = %q, want it to NOT reference the local forwarded port %d", gotCmd, localPort)
+	}
+}
@@ -0,0 +1,130 @@
+// repl_session.go
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// replSessionState is everything /save and /load persist for a single
+// interactive shell session: the message history plus the model/params in
+// effect when it was saved, so resuming a session picks its settings back
+// up too. Unlike saveSession's append-friendly JSONL sessions (the plain
+// save/load/list/rm commands), this is a single JSON document under
+// ~/.sumarai/sessions/<name>.json, matching how /save, /load and friends
+// are scoped to one named file per call rather than the autosave-on-every-
+// turn session used elsewhere in the shell.
+type replSessionState struct {
+	Messages    []Message `json:"messages"`
+	Model       string    `json:"model,omitempty"`
+	Temperature *float64  `json:"temperature,omitempty"`
+}
+
+func replSessionsDir() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(homeDir, ".sumarai", "sessions"), nil
+}
+
+func replSessionPath(name string) (string, error) {
+	if err := validSessionName(name); err != nil {
+		return "", err
+	}
+	dir, err := replSessionsDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, name+".json"), nil
+}
+
+// saveReplSession writes state as a single JSON document, overwriting any
+// existing file of the same name.
+func saveReplSession(name string, state replSessionState) error {
+	dir, err := replSessionsDir()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	path, err := replSessionPath(name)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+func loadReplSession(name string) (replSessionState, error) {
+	var state replSessionState
+
+	path, err := replSessionPath(name)
+	if err != nil {
+		return state, err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return state, err
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return state, err
+	}
+	return state, nil
+}
+
+// listReplSessionNames returns the names (without the .json suffix) of all
+// sessions saved with /save.
+func listReplSessionNames() ([]string, error) {
+	dir, err := replSessionsDir()
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), ".json") {
+			names = append(names, strings.TrimSuffix(e.Name(), ".json"))
+		}
+	}
+	return names, nil
+}
+
+// renameReplSession moves a session saved with /save to a new name.
+func renameReplSession(oldName, newName string) error {
+	oldPath, err := replSessionPath(oldName)
+	if err != nil {
+		return err
+	}
+	newPath, err := replSessionPath(newName)
+	if err != nil {
+		return err
+	}
+	return os.Rename(oldPath, newPath)
+}
+
+// deleteReplSession removes a session saved with /save.
+func deleteReplSession(name string) error {
+	path, err := replSessionPath(name)
+	if err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func newStubChatServer(t *testing.T, reply string) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprintf(w, "data: {\"choices\":[{\"delta\":{\"content\":%q},\"finish_reason\":null}]}\n\n", reply)
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+}
+
+func newReplTestClient(t *testing.T, server *httptest.Server) *LlamafileClient {
+	t.Helper()
+	addr, err := net.ResolveTCPAddr("tcp", server.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("failed to resolve stub server address: %v", err)
+	}
+	return &LlamafileClient{host: addr.IP.String(), port: addr.Port, scheme: "http"}
+}
+
+func withPipedStdin(t *testing.T, input string) {
+	t.Helper()
+	origStdin := os.Stdin
+	t.Cleanup(func() { os.Stdin = origStdin })
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("failed to create stdin pipe: %v", err)
+	}
+	os.Stdin = r
+	go func() {
+		w.WriteString(input)
+		w.Close()
+	}()
+}
+
+func TestInteractiveShellSlashCommandsSaveSession(t *testing.T) {
+	server := newStubChatServer(t, "hello there")
+	defer server.Close()
+	client := newReplTestClient(t, server)
+
+	sessionName := "repl-test-" + t.Name()
+	defer os.Remove(mustReplSessionPath(t, sessionName))
+
+	withPipedStdin(t, strings.Join([]string{
+		"/model test-model",
+		"hi",
+		"/save " + sessionName,
+		"exit",
+	}, "\n")+"\n")
+
+	captureStdout(t, func() {
+		InteractiveShell(client, "you are a test assistant", "", defaultHistoryTokenBudget)
+	})
+
+	state, err := loadReplSession(sessionName)
+	if err != nil {
+		t.Fatalf("expected /save to persist a loadable session, got error: %v", err)
+	}
+	if state.Model != "test-model" {
+		t.Errorf("expected saved model %q, got %q", "test-model", state.Model)
+	}
+
+	var sawAssistantReply bool
+	for _, msg := range state.Messages {
+		if msg.Role == "assistant" && msg.Content == "hello there" {
+			sawAssistantReply = true
+		}
+	}
+	if !sawAssistantReply {
+		t.Errorf("expected saved history to contain the assistant's reply, got %+v", state.Messages)
+	}
+}
+
+func TestInteractiveShellRetryRegeneratesLastReply(t *testing.T) {
+	server := newStubChatServer(t, "second reply")
+	defer server.Close()
+	client := newReplTestClient(t, server)
+
+	withPipedStdin(t, strings.Join([]string{
+		"hi",
+		"/retry",
+		"exit",
+	}, "\n")+"\n")
+
+	out := captureStdout(t, func() {
+		InteractiveShell(client, "you are a test assistant", "", defaultHistoryTokenBudget)
+	})
+
+	// One reply for "hi" and a regenerated one for "/retry".
+	if got := strings.Count(out, "AI: second reply"); got != 2 {
+		t.Errorf("expected /retry to regenerate the reply (2 replies printed), got %d in output %q", got, out)
+	}
+}
+
+func captureStdout(t *testing.T, fn func()) string {
+	t.Helper()
+	origStdout := os.Stdout
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("failed to create stdout pipe: %v", err)
+	}
+	os.Stdout = w
+
+	fn()
+
+	w.Close()
+	os.Stdout = origStdout
+
+	var b strings.Builder
+	buf := make([]byte, 4096)
+	for {
+		n, readErr := r.Read(buf)
+		if n > 0 {
+			b.Write(buf[:n])
+		}
+		if readErr != nil {
+			break
+		}
+	}
+	return b.String()
+}
+
+func TestReplSessionPathRejectsTraversal(t *testing.T) {
+	for _, name := range []string{"../escape", "../../tmp/x", "a/b", "/etc/passwd", "..", ".", ""} {
+		if _, err := replSessionPath(name); err == nil {
+			t.Errorf("replSessionPath(%q) = nil error, want rejection", name)
+		}
+	}
+
+	if _, err := replSessionPath("my-session"); err != nil {
+		t.Errorf("replSessionPath(%q) returned unexpected error: %v", "my-session", err)
+	}
+}
+
+func mustReplSessionPath(t *testing.T, name string) string {
+	t.Helper()
+	path, err := replSessionPath(name)
+	if err != nil {
+		t.Fatalf("replSessionPath failed: %v", err)
+	}
+	return path
+}
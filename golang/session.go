@@ -0,0 +1,260 @@
+// session.go
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// defaultHistoryCharBudget is defaultHistoryTokenBudget expressed in
+// characters (8000 tokens * charsPerToken): the budget trimHistory is held
+// to when summarizeHistory falls back to dropping the oldest non-system
+// messages with the default token budget.
+const defaultHistoryCharBudget = 32000
+
+// defaultHistoryTokenBudget is summarizeHistory's default token budget,
+// expressed in the same bytes/4 approximation as approxTokenCount.
+const defaultHistoryTokenBudget = 8000
+
+// historyKeepRecent is how many of the most recent messages summarizeHistory
+// always leaves untouched, so the model always sees the immediate context
+// of the conversation verbatim rather than as a summary.
+const historyKeepRecent = 4
+
+// validSessionName rejects session names that could escape the sessions
+// directory (e.g. "../../tmp/x") once joined with a ".jsonl"/".json"
+// suffix, since names come straight from user input on the save/load/rm/
+// /save/rename commands.
+func validSessionName(name string) error {
+	if name == "" {
+		return fmt.Errorf("session name must not be empty")
+	}
+	if name != filepath.Base(name) || name == "." || name == ".." {
+		return fmt.Errorf("invalid session name %q: must not contain path separators or \"..\"", name)
+	}
+	return nil
+}
+
+func sessionPath(name string) (string, error) {
+	if err := validSessionName(name); err != nil {
+		return "", err
+	}
+	dir, err := sessionsDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, name+".jsonl"), nil
+}
+
+// saveSession writes messages as one JSON object per line under
+// ~/.llamafile/sessions/<name>.jsonl, overwriting any existing file.
+func saveSession(name string, messages []Message) error {
+	dir, err := sessionsDir()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	path, err := sessionPath(name)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	enc := json.NewEncoder(f)
+	for _, msg := range messages {
+		if err := enc.Encode(msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadSession reads a session previously written by saveSession.
+func loadSession(name string) ([]Message, error) {
+	path, err := sessionPath(name)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var messages []Message
+	scanner := bufio.NewScanner(f)
+	// Session transcripts can run well past bufio.Scanner's 64KB default
+	// token limit once a few long chunk summaries accumulate.
+	scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var msg Message
+		if err := json.Unmarshal([]byte(line), &msg); err != nil {
+			return nil, fmt.Errorf("corrupt session line: %w", err)
+		}
+		messages = append(messages, msg)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+// listSessionNames returns the names (without the .jsonl suffix) of all
+// saved sessions.
+func listSessionNames() ([]string, error) {
+	dir, err := sessionsDir()
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), ".jsonl") {
+			names = append(names, strings.TrimSuffix(e.Name(), ".jsonl"))
+		}
+	}
+	return names, nil
+}
+
+func removeSession(name string) error {
+	path, err := sessionPath(name)
+	if err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+// sessionCharCount returns the total character count across a message
+// history, the cheapest available proxy for its size.
+func sessionCharCount(messages []Message) int {
+	total := 0
+	for _, msg := range messages {
+		total += len(msg.Content)
+	}
+	return total
+}
+
+// approxTokenCount estimates token usage using the common bytes/4
+// heuristic, since sumarai has no tokenizer of its own.
+func approxTokenCount(messages []Message) int {
+	return sessionCharCount(messages) / 4
+}
+
+// trimHistory drops the oldest non-system messages (preserving message 0
+// when it is a system prompt) until the remaining history's character
+// count fits within budget, or only the system prompt and the most recent
+// exchange remain.
+func trimHistory(messages []Message, budget int) []Message {
+	if sessionCharCount(messages) <= budget {
+		return messages
+	}
+
+	hasSystem := len(messages) > 0 && messages[0].Role == "system"
+	start := 0
+	if hasSystem {
+		start = 1
+	}
+
+	trimmed := append([]Message(nil), messages...)
+	for sessionCharCount(trimmed) > budget && len(trimmed) > start+2 {
+		trimmed = append(trimmed[:start], trimmed[start+1:]...)
+	}
+	return trimmed
+}
+
+// summarizeHistory keeps a conversation within budgetTokens by summarizing
+// its oldest messages into a single synthetic system message via a chat
+// completion, rather than trimHistory's blunter drop-the-oldest approach.
+// The leading system prompt (if any) and the most recent historyKeepRecent
+// messages are always left untouched, so a summarization failure or an
+// unhelpfully short summary never costs the model its instructions or the
+// immediate back-and-forth. Falls back to trimHistory if the summarization
+// call itself fails.
+func summarizeHistory(client *LlamafileClient, messages []Message, budgetTokens int) []Message {
+	if budgetTokens <= 0 {
+		budgetTokens = defaultHistoryTokenBudget
+	}
+	if approxTokenCount(messages) <= budgetTokens {
+		return messages
+	}
+
+	hasSystem := len(messages) > 0 && messages[0].Role == "system"
+	start := 0
+	if hasSystem {
+		start = 1
+	}
+
+	summarizeEnd := len(messages) - historyKeepRecent
+	if summarizeEnd <= start+1 {
+		// Not enough old messages to make summarizing them worthwhile.
+		return messages
+	}
+	toSummarize := messages[start:summarizeEnd]
+
+	var transcript strings.Builder
+	for _, msg := range toSummarize {
+		fmt.Fprintf(&transcript, "%s: %s\n", msg.Role, msg.Content)
+	}
+
+	summary, err := summarizeTranscript(client, transcript.String())
+	if err != nil {
+		logger.Warn("", "rolling history summarization failed, falling back to trimming", map[string]interface{}{"error": err.Error()})
+		return trimHistory(messages, budgetTokens*charsPerToken)
+	}
+
+	synthetic := Message{Role: "system", Content: "Summary of earlier conversation: " + summary}
+
+	out := make([]Message, 0, len(messages)-len(toSummarize)+2)
+	if hasSystem {
+		out = append(out, messages[0])
+	}
+	out = append(out, synthetic)
+	out = append(out, messages[summarizeEnd:]...)
+	return out
+}
+
+// summarizeTranscript asks the model for a concise summary of a rendered
+// conversation excerpt via a single non-streaming chat completion.
+func summarizeTranscript(client *LlamafileClient, transcript string) (string, error) {
+	resp, err := client.ChatCompletion([]Message{
+		{Role: "user", Content: "Summarize the following conversation excerpt concisely, preserving important facts and decisions:\n\n" + transcript},
+	}, false)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var out ChatCompletionResponse
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return "", err
+	}
+	if len(out.Choices) == 0 {
+		return "", fmt.Errorf("summarization returned no choices")
+	}
+	return out.content(0), nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSessionPathRejectsTraversal(t *testing.T) {
+	for _, name := range []string{"../escape", "../../tmp/x", "a/b", "/etc/passwd", "..", ".", ""} {
+		if _, err := sessionPath(name); err == nil {
+			t.Errorf("sessionPath(%q) = nil error, want rejection", name)
+		}
+	}
+
+	if _, err := sessionPath("my-session"); err != nil {
+		t.Errorf("sessionPath(%q) returned unexpected error: %v", "my-session", err)
+	}
+}
+
+func TestSummarizeHistoryNoOpUnderBudget(t *testing.T) {
+	client := &LlamafileClient{}
+	messages := []Message{
+		{Role: "system", Content: "you are a test assistant"},
+		{Role: "user", Content: "hi"},
+		{Role: "assistant", Content: "hello"},
+	}
+
+	got := summarizeHistory(client, messages, defaultHistoryTokenBudget)
+	if len(got) != len(messages) {
+		t.Fatalf("expected summarizeHistory to leave a small history untouched, got %d messages, want %d", len(got), len(messages))
+	}
+}
+
+func TestSummarizeHistoryCollapsesOldMessages(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"condensed summary"},"finish_reason":"stop"}]}`))
+	}))
+	defer server.Close()
+
+	client := newReplTestClient(t, server)
+
+	messages := []Message{{Role: "system", Content: "you are a test assistant"}}
+	for i := 0; i < 20; i++ {
+		messages = append(messages, Message{Role: "user", Content: strings.Repeat("x", 200)})
+		messages = append(messages, Message{Role: "assistant", Content: strings.Repeat("y", 200)})
+	}
+
+	got := summarizeHistory(client, messages, 10)
+
+	if len(got) >= len(messages) {
+		t.Fatalf("expected summarization to shrink the history, got %d messages from %d", len(got), len(messages))
+	}
+	if got[0].Role != "system" || got[0].Content != messages[0].Content {
+		t.Errorf("expected the original system prompt to survive summarization, got %+v", got[0])
+	}
+
+	var sawSummary bool
+	for _, msg := range got {
+		if msg.Role == "system" && strings.Contains(msg.Content, "condensed summary") {
+			sawSummary = true
+		}
+	}
+	if !sawSummary {
+		t.Errorf("expected a synthetic system message containing the model's summary, got %+v", got)
+	}
+
+	for _, msg := range got[len(got)-historyKeepRecent:] {
+		if msg.Content != strings.Repeat("x", 200) && msg.Content != strings.Repeat("y", 200) {
+			t.Errorf("expected the most recent messages to survive verbatim, got %+v", msg)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	ConfigureLogging(false, "error", "text", "", nil)
+	os.Exit(m.Run())
+}
+
+func TestWaitForDrainCompletesBeforeTimeout(t *testing.T) {
+	client := &LlamafileClient{}
+
+	client.inFlight.Add(1)
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		client.inFlight.Done()
+	}()
+
+	if !client.waitForDrain(500 * time.Millisecond) {
+		t.Error("expected waitForDrain to report success once the in-flight call finished")
+	}
+}
+
+func TestWaitForDrainTimesOutWhileInFlight(t *testing.T) {
+	client := &LlamafileClient{}
+
+	client.inFlight.Add(1)
+	defer client.inFlight.Done() // still "in flight" when the timeout fires below
+
+	if client.waitForDrain(20 * time.Millisecond) {
+		t.Error("expected waitForDrain to time out while a call is still in flight")
+	}
+}
+
+func TestChatCompletionTracksInFlight(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(80 * time.Millisecond)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices":[{"delta":{"content":"ok"},"finish_reason":"stop"}]}`))
+	}))
+	defer server.Close()
+
+	client := newTestClientForServer(t, server)
+
+	done := make(chan struct{})
+	go func() {
+		resp, err := client.ChatCompletion([]Message{{Role: "user", Content: "hi"}}, false)
+		if err != nil {
+			t.Errorf("ChatCompletion failed: %v", err)
+		} else {
+			resp.Body.Close()
+		}
+		close(done)
+	}()
+
+	time.Sleep(20 * time.Millisecond)
+	if client.waitForDrain(10 * time.Millisecond) {
+		t.Error("expected waitForDrain to report the chat completion as still in flight")
+	}
+
+	<-done
+	if !client.waitForDrain(10 * time.Millisecond) {
+		t.Error("expected waitForDrain to report drained once ChatCompletion returned")
+	}
+}
+
+func newTestClientForServer(t *testing.T, server *httptest.Server) *LlamafileClient {
+	t.Helper()
+	u, err := net.ResolveTCPAddr("tcp", server.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("failed to resolve test server address: %v", err)
+	}
+	return &LlamafileClient{host: u.IP.String(), port: u.Port, scheme: "http"}
+}
@@ -0,0 +1,74 @@
+// sse.go
+package main
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+// sseEvent is one Server-Sent Event: possibly-multi-line data, joined with
+// "\n" per the SSE spec, plus its optional event and id fields.
+type sseEvent struct {
+	Event string
+	ID    string
+	Data  string
+}
+
+// sseReader parses a text/event-stream body into typed sseEvents, emitted
+// on Events as they complete (on each blank-line event boundary), fixing
+// the ad-hoc line-by-line parsing this package used before: it correctly
+// joins multi-line "data:" fields, tolerates "\r\n" line endings, and
+// surfaces "event:"/"id:" instead of discarding them.
+type sseReader struct {
+	Events chan sseEvent
+	r      *bufio.Reader
+}
+
+func newSSEReader(body io.Reader) *sseReader {
+	sr := &sseReader{
+		Events: make(chan sseEvent),
+		r:      bufio.NewReader(body),
+	}
+	go sr.run()
+	return sr
+}
+
+func (sr *sseReader) run() {
+	defer close(sr.Events)
+
+	var dataLines []string
+	var event, id string
+
+	flush := func() {
+		if len(dataLines) == 0 && event == "" && id == "" {
+			return
+		}
+		sr.Events <- sseEvent{Event: event, ID: id, Data: strings.Join(dataLines, "\n")}
+		dataLines = nil
+		event = ""
+		id = ""
+	}
+
+	for {
+		line, err := sr.r.ReadString('\n')
+		line = strings.TrimRight(line, "\r\n")
+
+		if line == "" {
+			flush()
+		} else if strings.HasPrefix(line, "data:") {
+			dataLines = append(dataLines, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		} else if strings.HasPrefix(line, "event:") {
+			event = strings.TrimPrefix(strings.TrimPrefix(line, "event:"), " ")
+		} else if strings.HasPrefix(line, "id:") {
+			id = strings.TrimPrefix(strings.TrimPrefix(line, "id:"), " ")
+		}
+		// Lines starting with ":" are comments and anything else is
+		// ignored per the SSE spec.
+
+		if err != nil {
+			flush()
+			return
+		}
+	}
+}
@@ -0,0 +1,114 @@
+// stream.go
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+)
+
+// ChatCompletionDelta is one incremental piece of a streamed chat
+// completion, as delivered to StreamChatCompletion's callback.
+type ChatCompletionDelta struct {
+	Role         string
+	Content      string
+	FinishReason string
+	Usage        *ChatCompletionUsage
+}
+
+// StreamChatCompletion issues a streaming chat completion request and
+// invokes onDelta once per incremental chunk as it arrives, instead of
+// making the caller parse the event-stream body itself. The request is
+// bound to ctx, so canceling ctx (e.g. on Ctrl-C) stops the in-flight
+// stream and StreamChatCompletion returns ctx.Err().
+func (client *LlamafileClient) StreamChatCompletion(ctx context.Context, messages []Message, model string, temperature *float64, onDelta func(ChatCompletionDelta) error) error {
+	client.inFlight.Add(1)
+	defer client.inFlight.Done()
+	client.recordRequest()
+
+	requestID := newRequestID()
+
+	if model == "" {
+		model = "local-model"
+	}
+
+	scheme := client.scheme
+	if scheme == "" {
+		scheme = "http"
+	}
+	url := fmt.Sprintf("%s://%s:%d/v1/chat/completions", scheme, client.host, client.port)
+
+	body, err := json.Marshal(ChatCompletionRequest{Model: model, Messages: messages, Stream: true, Temperature: temperature})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if client.apiKey != "" {
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", client.apiKey))
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	logger.Debug(requestID, "starting streaming chat completion", map[string]interface{}{"model": model, "messages": len(messages)})
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		data, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("streaming chat completion failed: %d %s", resp.StatusCode, string(data))
+	}
+
+	sse := newSSEReader(resp.Body)
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case event, ok := <-sse.Events:
+			if !ok {
+				return nil
+			}
+			if event.Data == "[DONE]" {
+				return nil
+			}
+
+			var chunk ChatCompletionResponse
+			if err := json.Unmarshal([]byte(event.Data), &chunk); err != nil {
+				continue
+			}
+			if chunk.Usage != nil {
+				client.recordTokens(chunk.Usage.TotalTokens)
+			}
+			if len(chunk.Choices) == 0 && chunk.Usage != nil {
+				// The final chunk of a stream with usage reporting enabled
+				// carries Usage but no choices.
+				if err := onDelta(ChatCompletionDelta{Usage: chunk.Usage}); err != nil {
+					return err
+				}
+				continue
+			}
+			for _, choice := range chunk.Choices {
+				delta := ChatCompletionDelta{
+					Content:      CleanContent(choice.Delta.Content),
+					FinishReason: choice.FinishReason,
+					Usage:        chunk.Usage,
+				}
+				if err := onDelta(delta); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
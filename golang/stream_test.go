@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newStreamTestClient(t *testing.T, server *httptest.Server) *LlamafileClient {
+	t.Helper()
+	addr, err := net.ResolveTCPAddr("tcp", server.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("failed to resolve test server address: %v", err)
+	}
+	return &LlamafileClient{host: addr.IP.String(), port: addr.Port, scheme: "http"}
+}
+
+// TestStreamChatCompletionOrdersDeltas feeds a scripted multi-chunk SSE
+// body, including a final usage-only chunk, and asserts onDelta sees the
+// chunks in the order the server sent them.
+func TestStreamChatCompletionOrdersDeltas(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		flusher := w.(http.Flusher)
+
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"Hello\"},\"finish_reason\":null}]}\n\n")
+		flusher.Flush()
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\", world\"},\"finish_reason\":null}]}\n\n")
+		flusher.Flush()
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"\"},\"finish_reason\":\"stop\"}]}\n\n")
+		flusher.Flush()
+		fmt.Fprint(w, "data: {\"choices\":[],\"usage\":{\"prompt_tokens\":3,\"completion_tokens\":2,\"total_tokens\":5}}\n\n")
+		flusher.Flush()
+		fmt.Fprint(w, "data: [DONE]\n\n")
+		flusher.Flush()
+	}))
+	defer server.Close()
+
+	client := newStreamTestClient(t, server)
+
+	var gotContent []string
+	var gotFinish []string
+	var gotUsage *ChatCompletionUsage
+
+	err := client.StreamChatCompletion(context.Background(), []Message{{Role: "user", Content: "hi"}}, "", nil, func(d ChatCompletionDelta) error {
+		gotContent = append(gotContent, d.Content)
+		gotFinish = append(gotFinish, d.FinishReason)
+		if d.Usage != nil {
+			gotUsage = d.Usage
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("StreamChatCompletion returned error: %v", err)
+	}
+
+	wantContent := []string{"Hello", ", world", "", ""}
+	if len(gotContent) != len(wantContent) {
+		t.Fatalf("got %d deltas %v, want %d: %v", len(gotContent), gotContent, len(wantContent), wantContent)
+	}
+	for i, want := range wantContent {
+		if gotContent[i] != want {
+			t.Errorf("delta %d content = %q, want %q", i, gotContent[i], want)
+		}
+	}
+	if gotFinish[2] != "stop" {
+		t.Errorf("expected the third delta's finish_reason to be %q, got %q", "stop", gotFinish[2])
+	}
+	if gotUsage == nil || gotUsage.TotalTokens != 5 {
+		t.Errorf("expected the final usage-only chunk to report TotalTokens=5, got %+v", gotUsage)
+	}
+}
+
+// TestStreamChatCompletionStopsOnCancel cancels ctx partway through a
+// stream that would otherwise block indefinitely, and asserts
+// StreamChatCompletion returns promptly with ctx.Err() instead of hanging
+// until the server closes the connection.
+func TestStreamChatCompletionStopsOnCancel(t *testing.T) {
+	block := make(chan struct{})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		flusher := w.(http.Flusher)
+
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"first\"},\"finish_reason\":null}]}\n\n")
+		flusher.Flush()
+		<-block // hold the connection open until the test is done with it
+	}))
+	// server.Close waits for the handler goroutine above to return, so
+	// block must be closed (unblocking the handler) before that; deferring
+	// it after server.Close() runs it first, per defer's LIFO order.
+	defer server.Close()
+	defer close(block)
+
+	client := newStreamTestClient(t, server)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan struct{})
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- client.StreamChatCompletion(ctx, []Message{{Role: "user", Content: "hi"}}, "", nil, func(d ChatCompletionDelta) error {
+			close(first)
+			return nil
+		})
+	}()
+
+	select {
+	case <-first:
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for the first delta")
+	}
+	cancel()
+
+	select {
+	case err := <-errCh:
+		if err != context.Canceled {
+			t.Errorf("expected StreamChatCompletion to return context.Canceled, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("StreamChatCompletion did not return promptly after ctx was canceled")
+	}
+}
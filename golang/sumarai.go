@@ -4,6 +4,8 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"context"
+	"crypto/rand"
 	"encoding/json"
 	"errors"
 	"flag"
@@ -19,6 +21,8 @@ import (
 	"runtime"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 )
@@ -30,15 +34,103 @@ const (
 	defaultHost   = "localhost"
 	defaultPort   = 8080
 	defaultPrompt = "You are a helpful AI assistant. Respond to the user's queries concisely and accurately."
+
+	defaultStopGracePeriod = 10 * time.Second
+
+	defaultMinRunSeconds = 10 * time.Second
+	defaultMaxRetries    = 3
+)
+
+// supervisorState names a state in the supervisor's restart state machine,
+// reported through the ctl socket's "state" verb and the "stats" verb.
+type supervisorState string
+
+const (
+	stateStarting supervisorState = "Starting"
+	stateRunning  supervisorState = "Running"
+	stateBackoff  supervisorState = "Backoff"
+	stateFatal    supervisorState = "Fatal"
+	stateStopped  supervisorState = "Stopped"
 )
 
 type LlamafileClient struct {
-	executablePath string
-	apiKey         string
-	host           string
-	port           int
-	process        *os.Process
-	serviceMode    bool
+	executablePath  string
+	apiKey          string
+	host            string
+	port            int
+	process         *os.Process
+	serviceMode     bool
+	stopGracePeriod time.Duration
+	systemPrompt    string
+	ctlListener     net.Listener
+
+	// scheme is "http" or "https", switched to "https" by configureTLS.
+	scheme      string
+	tlsCertFile string
+	tlsKeyFile  string
+
+	// remoteSpec and remoteSession are set by configureRemote when llamafile
+	// is run on another host over SSH instead of locally.
+	remoteSpec    string
+	remoteSession *remoteSession
+
+	// inFlight tracks ChatCompletion/StreamChatCompletion calls that have
+	// not yet returned, so StopLlamafile can drain them before killing the
+	// server. drainMu guards draining, which checkServerStatus and the ctl
+	// socket's "status" verb report while StopLlamafile is in progress.
+	inFlight sync.WaitGroup
+	drainMu  sync.Mutex
+	draining bool
+
+	// startedAt, requestCount, and tokenCount back the ctl socket's "stats"
+	// verb. requestCount and tokenCount are updated with atomic ops rather
+	// than drainMu since they're incremented far more often than read.
+	startedAt    time.Time
+	requestCount int64
+	tokenCount   int64
+
+	// minRunSeconds and maxRetries tune supervise's crash-loop handling: a
+	// run shorter than minRunSeconds counts against maxRetries, and
+	// exhausting maxRetries moves the supervisor to stateFatal instead of
+	// retrying forever. Zero values fall back to the defaults below.
+	minRunSeconds time.Duration
+	maxRetries    int
+
+	stateMu sync.Mutex
+	state   supervisorState
+}
+
+// setState updates the supervisor's state machine position.
+func (client *LlamafileClient) setState(s supervisorState) {
+	client.stateMu.Lock()
+	client.state = s
+	client.stateMu.Unlock()
+}
+
+// getState returns the supervisor's current state, or stateStopped if
+// supervise has never run (e.g. llamafile was started outside -service mode).
+func (client *LlamafileClient) getState() supervisorState {
+	client.stateMu.Lock()
+	defer client.stateMu.Unlock()
+	if client.state == "" {
+		return stateStopped
+	}
+	return client.state
+}
+
+// recordRequest increments the request counter the ctl socket's "stats"
+// verb reports.
+func (client *LlamafileClient) recordRequest() {
+	atomic.AddInt64(&client.requestCount, 1)
+}
+
+// recordTokens adds n to the token counter the ctl socket's "stats" verb
+// reports; n is typically a ChatCompletionUsage.TotalTokens value.
+func (client *LlamafileClient) recordTokens(n int) {
+	if n <= 0 {
+		return
+	}
+	atomic.AddInt64(&client.tokenCount, int64(n))
 }
 
 type Message struct {
@@ -47,18 +139,45 @@ type Message struct {
 }
 
 type ChatCompletionRequest struct {
-	Model    string    `json:"model"`
-	Messages []Message `json:"messages"`
-	Stream   bool      `json:"stream"`
+	Model       string    `json:"model"`
+	Messages    []Message `json:"messages"`
+	Stream      bool      `json:"stream"`
+	Temperature *float64  `json:"temperature,omitempty"`
 }
 
 type ChatCompletionResponse struct {
 	Choices []struct {
+		// Delta carries content in a streaming chunk; Message carries it in
+		// a complete, non-streaming response. A given response populates
+		// only one of the two.
 		Delta struct {
 			Content string `json:"content"`
 		} `json:"delta"`
+		Message struct {
+			Content string `json:"content"`
+		} `json:"message"`
 		FinishReason string `json:"finish_reason"`
 	} `json:"choices"`
+	Usage *ChatCompletionUsage `json:"usage,omitempty"`
+}
+
+// content returns a choice's text regardless of whether it arrived as a
+// streaming delta or a non-streaming message.
+func (c *ChatCompletionResponse) content(i int) string {
+	choice := c.Choices[i]
+	if choice.Message.Content != "" {
+		return choice.Message.Content
+	}
+	return choice.Delta.Content
+}
+
+// ChatCompletionUsage carries the token accounting llamafile reports on
+// non-streaming (and final streaming) responses, used to enrich log events
+// with prompt/completion/total token counts.
+type ChatCompletionUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
 }
 
 func CleanContent(content string) string {
@@ -74,10 +193,65 @@ func CleanContent(content string) string {
 	return content
 }
 
-func ConfigureLogging(debugEnabled bool) {
+// logger is the process-wide structured logger, initialized by
+// ConfigureLogging before any other subsystem is used.
+var logger Logger
+
+// ConfigureLogging builds the process-wide logger from the -log-level,
+// -log-format and -log-file flags, falling back to the LLAMAFILE_LOG_LEVEL
+// environment variable when -log-level is left at its default. debugEnabled
+// forces LevelDebug regardless of the configured level, preserving the
+// behaviour of the original -debug flag.
+// ConfigureLogging builds the package-level logger from -debug/-log-level/
+// -log-format/-log-file, or, when sinks is non-empty, fans events out to
+// each of those sinks instead (see -log and LogSink).
+func ConfigureLogging(debugEnabled bool, levelFlag, format, logFile string, sinks []LogSink) {
+	level, err := parseLogLevel(levelFlag)
+	if err != nil {
+		if envLevel := os.Getenv("LLAMAFILE_LOG_LEVEL"); envLevel != "" {
+			level, err = parseLogLevel(envLevel)
+		}
+		if err != nil {
+			level = LevelInfo
+		}
+	} else if levelFlag == "" {
+		if envLevel := os.Getenv("LLAMAFILE_LOG_LEVEL"); envLevel != "" {
+			if parsed, perr := parseLogLevel(envLevel); perr == nil {
+				level = parsed
+			}
+		}
+	}
+
 	if debugEnabled {
-		// Enable detailed logging if needed
+		level = LevelDebug
 	}
+
+	if len(sinks) > 0 {
+		l, err := NewMultiLogger(level, sinks)
+		if err != nil {
+			fmt.Printf("Error configuring log sinks: %s\n", err.Error())
+		} else {
+			logger = l
+			return
+		}
+	}
+
+	l, err := NewLogger(level, format, logFile, 10, 3)
+	if err != nil {
+		fmt.Printf("Error configuring logging: %s\n", err.Error())
+		l, _ = NewLogger(level, format, "", 10, 3)
+	}
+	logger = l
+}
+
+// newRequestID returns a short random identifier used to correlate a single
+// ChatCompletion call across log events.
+func newRequestID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("req-%d", time.Now().UnixNano())
+	}
+	return fmt.Sprintf("req-%x", b)
 }
 
 func NewLlamafileClient(executablePath string, serviceMode bool) (*LlamafileClient, error) {
@@ -86,25 +260,100 @@ func NewLlamafileClient(executablePath string, serviceMode bool) (*LlamafileClie
 		return nil, err
 	}
 
-	apiKey := ""
-	apiKeyFilePath := filepath.Join(os.Getenv("HOME"), llamafileDir, apiKeyFile)
-	if data, err := ioutil.ReadFile(apiKeyFilePath); err == nil {
-		apiKey = strings.TrimSpace(string(data))
-	} else {
-		apiKey = generateAPIKey()
+	apiKey, err := loadOrCreateAPIKey()
+	if err != nil {
+		return nil, err
 	}
 
 	return &LlamafileClient{
-		executablePath: execPath,
-		apiKey:         apiKey,
-		host:           defaultHost,
-		port:           defaultPort,
-		serviceMode:    serviceMode,
+		executablePath:  execPath,
+		apiKey:          apiKey,
+		host:            defaultHost,
+		port:            defaultPort,
+		serviceMode:     serviceMode,
+		stopGracePeriod: defaultStopGracePeriod,
+		scheme:          "http",
 	}, nil
 }
 
+// minAPIKeyLength is the length, in hex characters, below which a
+// persisted key is considered too weak (e.g. from a pre-crypto/rand
+// version of sumarai) and is rotated automatically.
+const minAPIKeyLength = 64
+
+// generateAPIKey returns a cryptographically random 64-character hex
+// string (32 bytes of entropy from crypto/rand), unlike a timestamp-based
+// key, which an attacker who can estimate process start time could guess.
 func generateAPIKey() string {
-	return fmt.Sprintf("%x", time.Now().UnixNano())
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		// crypto/rand failing indicates a broken system entropy source;
+		// there is no safe fallback, so surface it loudly rather than
+		// silently handing out a predictable key.
+		logger.Fatal("", "failed to read random bytes for API key generation", map[string]interface{}{"error": err.Error()})
+	}
+	return fmt.Sprintf("%x", b)
+}
+
+// apiKeyFilePath returns the path sumarai persists its API key to.
+func apiKeyFilePath() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(homeDir, llamafileDir, apiKeyFile), nil
+}
+
+// loadOrCreateAPIKey reads the persisted API key. It refuses to load (and
+// returns an error) if the file grants any group or other permissions, and
+// generates a fresh key if the stored one is shorter than minAPIKeyLength,
+// which can only happen if it predates generateAPIKey's move to crypto/rand.
+func loadOrCreateAPIKey() (string, error) {
+	path, err := apiKeyFilePath()
+	if err != nil {
+		return "", err
+	}
+
+	if info, err := os.Stat(path); err == nil {
+		if info.Mode().Perm()&0077 != 0 {
+			return "", fmt.Errorf("refusing to load API key file %s: permissions %v are too open, expected 0600", path, info.Mode().Perm())
+		}
+		if data, err := ioutil.ReadFile(path); err == nil {
+			key := strings.TrimSpace(string(data))
+			if len(key) >= minAPIKeyLength {
+				return key, nil
+			}
+		}
+	}
+
+	key := generateAPIKey()
+	if err := persistAPIKey(path, key); err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+func persistAPIKey(path, key string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, []byte(key), 0600)
+}
+
+// rotateAPIKey generates a new API key, persists it in place of the old
+// one, and updates the client so a subsequent (re)start of llamafile picks
+// it up.
+func (client *LlamafileClient) rotateAPIKey() error {
+	path, err := apiKeyFilePath()
+	if err != nil {
+		return err
+	}
+	newKey := generateAPIKey()
+	if err := persistAPIKey(path, newKey); err != nil {
+		return err
+	}
+	client.apiKey = newKey
+	return nil
 }
 
 func findExecutable(executablePath string) (string, error) {
@@ -162,6 +411,10 @@ func fileExistsAndExecutable(path string) bool {
 }
 
 func (client *LlamafileClient) StartLlamafile(daemon bool) error {
+	if client.remoteSession != nil {
+		return client.startRemote()
+	}
+
 	if client.executablePath == "" {
 		return errors.New("llamafile executable not found")
 	}
@@ -198,16 +451,20 @@ func (client *LlamafileClient) StartLlamafile(daemon bool) error {
 }
 
 func (client *LlamafileClient) buildCommand() (*exec.Cmd, error) {
-	apiKeyArg := fmt.Sprintf("--api-key %s", client.apiKey)
+	args := fmt.Sprintf("--api-key %s", client.apiKey)
+	if client.scheme == "https" {
+		args += fmt.Sprintf(" --ssl-cert-file %s --ssl-key-file %s", client.tlsCertFile, client.tlsKeyFile)
+	}
+
 	var cmd *exec.Cmd
 
 	if runtime.GOOS == "windows" {
 		// Use cmd.exe on Windows
-		cmdLine := fmt.Sprintf("%s %s", client.executablePath, apiKeyArg)
+		cmdLine := fmt.Sprintf("%s %s", client.executablePath, args)
 		cmd = exec.Command("cmd", "/C", cmdLine)
 	} else {
 		// Use sh on Unix-like systems
-		cmdLine := fmt.Sprintf("%s %s", client.executablePath, apiKeyArg)
+		cmdLine := fmt.Sprintf("%s %s", client.executablePath, args)
 		cmd = exec.Command("sh", "-c", cmdLine)
 	}
 
@@ -216,6 +473,8 @@ func (client *LlamafileClient) buildCommand() (*exec.Cmd, error) {
 }
 
 func (client *LlamafileClient) startDaemon() error {
+	client.startedAt = time.Now()
+
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
 		return err
@@ -228,57 +487,177 @@ func (client *LlamafileClient) startDaemon() error {
 		}
 	}
 
-	cmd, err := client.buildCommand()
-	if err != nil {
+	if err := daemonize(filepath.Join(llamaDir, "sumarai.log")); err != nil {
 		return err
 	}
 
-	// Set process attributes conditionally
-	if runtime.GOOS != "windows" {
-		// Unix-like systems
-		cmd.SysProcAttr = &syscall.SysProcAttr{
-			Setsid: true,
-		}
-	} else {
-		// Windows systems
-		// Avoid setting SysProcAttr fields that are not defined on Unix-like systems
-		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	// From here on we are the detached child (or, on platforms without
+	// daemonize support, still the foreground process): write the files a
+	// client needs to find and talk to us, then supervise llamafile.
+	pidFilePath := filepath.Join(llamaDir, pidFileName)
+	if err := ioutil.WriteFile(pidFilePath, []byte(fmt.Sprintf("%d", os.Getpid())), 0644); err != nil {
+		return err
 	}
+	defer os.Remove(pidFilePath)
 
-	// Start the process
-	if err := cmd.Start(); err != nil {
+	apiKeyFilePath := filepath.Join(llamaDir, apiKeyFile)
+	if err := ioutil.WriteFile(apiKeyFilePath, []byte(client.apiKey), 0600); err != nil {
 		return err
 	}
 
-	// Write pid file
-	pidFilePath := filepath.Join(llamaDir, pidFileName)
-	err = ioutil.WriteFile(pidFilePath, []byte(fmt.Sprintf("%d", cmd.Process.Pid)), 0644)
+	go func() {
+		if err := client.serveCtl(); err != nil {
+			logger.Warn("", "ctl socket stopped", map[string]interface{}{"error": err.Error()})
+		}
+	}()
+
+	return client.supervise()
+}
+
+// supervise starts llamafile and keeps it running: a SIGHUP triggers a
+// config reload (currently just re-reading the API key file), a SIGTERM
+// stops it gracefully and returns, and any unexpected exit is restarted
+// with exponential backoff (1s, 2s, 4s, ... capped at 30s). A run that ends
+// before minRunSeconds counts against maxRetries; exhausting maxRetries
+// moves the supervisor to stateFatal and returns an error instead of
+// retrying forever, since a crash loop that never stays up is not something
+// backoff alone will fix. The subprocess's stdout/stderr are captured into
+// ~/.llamafile/llamafile.log with size-based rotation.
+func (client *LlamafileClient) supervise() error {
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(sigCh)
+
+	minRun := client.minRunSeconds
+	if minRun <= 0 {
+		minRun = defaultMinRunSeconds
+	}
+	maxRetries := client.maxRetries
+	if maxRetries <= 0 {
+		maxRetries = defaultMaxRetries
+	}
+	retriesLeft := maxRetries
+
+	homeDir, err := os.UserHomeDir()
 	if err != nil {
 		return err
 	}
-
-	// Write API key file
-	apiKeyFilePath := filepath.Join(llamaDir, apiKeyFile)
-	err = ioutil.WriteFile(apiKeyFilePath, []byte(client.apiKey), 0600)
+	procLog, err := newRotatingWriter(filepath.Join(homeDir, llamafileDir, "llamafile.log"), 10, 3)
 	if err != nil {
 		return err
 	}
+	defer procLog.Close()
 
-	return nil
+	backoff := 1 * time.Second
+	const maxBackoff = 30 * time.Second
+
+	for {
+		client.setState(stateStarting)
+
+		cmd, err := client.buildCommand()
+		if err != nil {
+			return err
+		}
+		if runtime.GOOS != "windows" {
+			cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+		} else {
+			cmd.SysProcAttr = &syscall.SysProcAttr{}
+		}
+		cmd.Stdout = procLog
+		cmd.Stderr = procLog
+
+		start := time.Now()
+		if err := cmd.Start(); err != nil {
+			logger.Error("", "supervisor failed to start llamafile", map[string]interface{}{"error": err.Error()})
+			return err
+		}
+		client.process = cmd.Process
+		client.setState(stateRunning)
+		logger.Info("", "supervisor started llamafile", map[string]interface{}{"pid": cmd.Process.Pid})
+
+		exited := make(chan error, 1)
+		go func() { exited <- cmd.Wait() }()
+
+		select {
+		case sig := <-sigCh:
+			switch sig {
+			case syscall.SIGHUP:
+				logger.Info("", "supervisor reloading config on SIGHUP", nil)
+
+				// Stop the running child before looping back to buildCommand,
+				// otherwise the old process is leaked and the new one fails to
+				// bind the same host:port. cmd.Wait() is already running in the
+				// exited goroutine above, so wait on that channel rather than
+				// calling process.Wait() a second time.
+				if runtime.GOOS == "windows" {
+					client.process.Kill()
+				} else if err := client.process.Signal(syscall.SIGTERM); err != nil {
+					logger.Warn("", "failed to signal llamafile for reload", map[string]interface{}{"error": err.Error()})
+				}
+				select {
+				case <-exited:
+				case <-time.After(client.stopGracePeriod):
+					logger.Warn("", "llamafile did not exit within grace period during reload, sending SIGKILL", map[string]interface{}{"pid": client.process.Pid})
+					client.process.Kill()
+					<-exited
+				}
+
+				if key, err := loadOrCreateAPIKey(); err == nil {
+					client.apiKey = key
+				} else {
+					logger.Warn("", "failed to reload API key on SIGHUP", map[string]interface{}{"error": err.Error()})
+				}
+				continue
+			case syscall.SIGTERM:
+				logger.Info("", "supervisor stopping llamafile on SIGTERM", nil)
+				client.setState(stateStopped)
+				return client.StopLlamafile()
+			}
+		case err := <-exited:
+			ran := time.Since(start)
+			logger.Warn("", "llamafile exited unexpectedly", map[string]interface{}{"error": fmt.Sprint(err), "ran_for": ran.String()})
+
+			if ran >= minRun {
+				retriesLeft = maxRetries
+			} else {
+				retriesLeft--
+				if retriesLeft <= 0 {
+					client.setState(stateFatal)
+					return fmt.Errorf("llamafile exited within %s of starting %d times in a row; giving up", minRun, maxRetries)
+				}
+			}
+
+			client.setState(stateBackoff)
+			time.Sleep(backoff)
+			backoff *= 2
+			if backoff > maxBackoff {
+				backoff = maxBackoff
+			}
+		}
+	}
 }
 
 func (client *LlamafileClient) waitForServer() error {
-	timeout := time.After(60 * time.Second)
-	tick := time.Tick(1 * time.Second)
+	return client.waitForServerWithin(60*time.Second, 1*time.Second)
+}
+
+// waitForServerWithin is waitForServer with the timeout and poll interval
+// broken out so tests can exercise the timeout path without waiting 60s;
+// production code should call waitForServer.
+func (client *LlamafileClient) waitForServerWithin(timeout, tick time.Duration) error {
+	deadline := time.After(timeout)
+	ticker := time.Tick(tick)
 
 	for {
 		select {
-		case <-timeout:
+		case <-deadline:
+			logger.Error("", "llamafile server did not become ready within timeout", map[string]interface{}{"host": client.host, "port": client.port})
 			return errors.New("server did not become ready within the timeout period")
-		case <-tick:
+		case <-ticker:
 			conn, err := net.DialTimeout("tcp", fmt.Sprintf("%s:%d", client.host, client.port), 1*time.Second)
 			if err == nil {
 				conn.Close()
+				logger.Info("", "llamafile server is ready", map[string]interface{}{"host": client.host, "port": client.port})
 				return nil
 			}
 		}
@@ -286,14 +665,36 @@ func (client *LlamafileClient) waitForServer() error {
 }
 
 func (client *LlamafileClient) StopLlamafile() error {
+	if client.remoteSession != nil {
+		return client.stopRemote()
+	}
+
+	client.setDraining(true)
+	defer client.setDraining(false)
+
 	if client.process != nil {
-		if err := client.process.Kill(); err != nil {
-			return err
+		if !client.waitForDrain(client.stopGracePeriod) {
+			logger.Warn("", "shutdown timeout elapsed with chat completions still in flight; stopping anyway", map[string]interface{}{"timeout": client.stopGracePeriod.String(), "pid": client.process.Pid})
+		}
+
+		// Always try SIGTERM first (stopProcessGracefully escalates to
+		// SIGKILL on its own grace period) rather than killing outright,
+		// so llamafile gets a chance to clean up temp files and unload the
+		// model even when the drain above already timed out.
+		err := stopProcessGracefully(client.process, client.stopGracePeriod)
+		if err == nil {
+			logger.Info("", "llamafile process stopped", map[string]interface{}{"pid": client.process.Pid})
 		}
-		_, err := client.process.Wait()
 		return err
 	}
 
+	if resp, err := ctlClient("stop", nil); err == nil {
+		if !resp.OK {
+			return errors.New(resp.Error)
+		}
+		return nil
+	}
+
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
 		return err
@@ -316,10 +717,11 @@ func (client *LlamafileClient) StopLlamafile() error {
 		return fmt.Errorf("process with PID %d not found: %v", pidInt, err)
 	}
 
-	if err := process.Kill(); err != nil {
-		return fmt.Errorf("failed to kill process with PID %d: %v", pidInt, err)
+	if err := stopForeignProcessGracefully(process, client.stopGracePeriod); err != nil {
+		return err
 	}
 
+	logger.Info("", "killed llamafile process", map[string]interface{}{"pid": pidInt})
 	fmt.Printf("Killed process with PID %d\n", pidInt)
 
 	// Remove PID file
@@ -330,8 +732,112 @@ func (client *LlamafileClient) StopLlamafile() error {
 	return nil
 }
 
+// stopProcessGracefully sends SIGTERM and waits up to grace for the process
+// to exit on its own before escalating to SIGKILL. On Windows, where
+// SIGTERM is not a distinct signal, it kills immediately.
+func stopProcessGracefully(process *os.Process, grace time.Duration) error {
+	if runtime.GOOS == "windows" {
+		if err := process.Kill(); err != nil {
+			return err
+		}
+		_, err := process.Wait()
+		return err
+	}
+
+	if err := process.Signal(syscall.SIGTERM); err != nil {
+		return fmt.Errorf("failed to send SIGTERM to process %d: %v", process.Pid, err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := process.Wait()
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(grace):
+		logger.Warn("", "process did not exit within grace period, sending SIGKILL", map[string]interface{}{"pid": process.Pid, "grace": grace.String()})
+		if err := process.Kill(); err != nil {
+			return fmt.Errorf("failed to kill process %d after grace period: %v", process.Pid, err)
+		}
+		return <-done
+	}
+}
+
+// stopForeignProcessGracefully stops a process found by PID (not our own
+// child, so os.Process.Wait cannot be used to detect its exit) by sending
+// SIGTERM and polling for its disappearance, escalating to SIGKILL if it
+// outlives the grace period.
+func stopForeignProcessGracefully(process *os.Process, grace time.Duration) error {
+	if runtime.GOOS == "windows" {
+		return process.Kill()
+	}
+
+	if err := process.Signal(syscall.SIGTERM); err != nil {
+		return fmt.Errorf("failed to send SIGTERM to process %d: %v", process.Pid, err)
+	}
+
+	deadline := time.Now().Add(grace)
+	for time.Now().Before(deadline) {
+		if err := process.Signal(syscall.Signal(0)); err != nil {
+			return nil
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+
+	logger.Warn("", "process did not exit within grace period, sending SIGKILL", map[string]interface{}{"pid": process.Pid, "grace": grace.String()})
+	return process.Kill()
+}
+
+// isDraining reports whether StopLlamafile has begun shutting the server
+// down, so callers (checkServerStatus, the ctl socket's "status" verb)
+// can tell clients to stop sending new work.
+func (client *LlamafileClient) isDraining() bool {
+	client.drainMu.Lock()
+	defer client.drainMu.Unlock()
+	return client.draining
+}
+
+func (client *LlamafileClient) setDraining(draining bool) {
+	client.drainMu.Lock()
+	defer client.drainMu.Unlock()
+	client.draining = draining
+}
+
+// waitForDrain blocks until every ChatCompletion/StreamChatCompletion call
+// already in flight when StopLlamafile was invoked returns, or until
+// timeout elapses, returning false in the latter case so the caller can
+// stop waiting on the drain and move on to stopping the process.
+func (client *LlamafileClient) waitForDrain(timeout time.Duration) bool {
+	drained := make(chan struct{})
+	go func() {
+		client.inFlight.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
 func (client *LlamafileClient) ChatCompletion(messages []Message, stream bool) (*http.Response, error) {
-	url := fmt.Sprintf("http://%s:%d/v1/chat/completions", client.host, client.port)
+	client.inFlight.Add(1)
+	defer client.inFlight.Done()
+	client.recordRequest()
+
+	requestID := newRequestID()
+	start := time.Now()
+
+	scheme := client.scheme
+	if scheme == "" {
+		scheme = "http"
+	}
+	url := fmt.Sprintf("%s://%s:%d/v1/chat/completions", scheme, client.host, client.port)
 	requestBody := ChatCompletionRequest{
 		Model:    "local-model",
 		Messages: messages,
@@ -340,11 +846,13 @@ func (client *LlamafileClient) ChatCompletion(messages []Message, stream bool) (
 
 	jsonData, err := json.Marshal(requestBody)
 	if err != nil {
+		logger.Error(requestID, "failed to marshal chat completion request", map[string]interface{}{"error": err.Error()})
 		return nil, err
 	}
 
 	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
 	if err != nil {
+		logger.Error(requestID, "failed to build chat completion request", map[string]interface{}{"error": err.Error()})
 		return nil, err
 	}
 
@@ -353,21 +861,33 @@ func (client *LlamafileClient) ChatCompletion(messages []Message, stream bool) (
 	}
 	req.Header.Set("Content-Type", "application/json")
 
+	logger.Debug(requestID, "sending chat completion request", map[string]interface{}{"messages": len(messages), "stream": stream})
+
 	clientHTTP := &http.Client{}
 	resp, err := clientHTTP.Do(req)
 	if err != nil {
+		logger.Error(requestID, "chat completion request failed", map[string]interface{}{"error": err.Error()})
 		return nil, err
 	}
 
 	if resp.StatusCode != 200 {
 		bodyBytes, _ := ioutil.ReadAll(resp.Body)
+		logger.Error(requestID, "chat completion returned non-200 status", map[string]interface{}{"status": resp.StatusCode, "body": string(bodyBytes)})
 		return nil, fmt.Errorf("error: %d, %s", resp.StatusCode, string(bodyBytes))
 	}
 
+	logger.Info(requestID, "chat completion request succeeded", map[string]interface{}{"latency_ms": time.Since(start).Milliseconds()})
+
 	return resp, nil
 }
 
 func CheckServerStatus() {
+	if resp, err := ctlClient("status", nil); err == nil && resp.OK {
+		fmt.Println(resp.Data)
+		return
+	}
+
+	// No daemon answering on the ctl socket: fall back to a raw TCP probe.
 	conn, err := net.DialTimeout("tcp", fmt.Sprintf("%s:%d", defaultHost, defaultPort), 1*time.Second)
 	if err == nil {
 		fmt.Println("running")
@@ -377,11 +897,216 @@ func CheckServerStatus() {
 	}
 }
 
-func InteractiveShell(client *LlamafileClient, prompt string) {
+// InteractiveShell runs a REPL against client. If sessionName is non-empty
+// and a session by that name was previously saved, its history is loaded
+// instead of starting fresh from prompt; "save"/"load"/"list"/"rm" let the
+// user manage saved sessions without restarting.
+func InteractiveShell(client *LlamafileClient, prompt string, sessionName string, historyTokenBudget int) {
 	fmt.Println("Welcome to the interactive shell. Type 'help' for available commands or 'exit' to quit.")
+
 	conversationHistory := []Message{
 		{Role: "system", Content: prompt},
 	}
+	if sessionName != "" {
+		if loaded, err := loadSession(sessionName); err == nil {
+			conversationHistory = loaded
+			fmt.Printf("Resumed session %q (%d messages, ~%d tokens)\n", sessionName, len(loaded), approxTokenCount(loaded))
+		}
+	}
+
+	var model string
+	var temperature *float64
+	var usageTotals ChatCompletionUsage
+
+	// runTurn streams a completion for the current conversationHistory,
+	// printing tokens as they arrive and appending the assistant's reply
+	// (and any reported token usage) once the stream finishes. It is shared
+	// by plain input and /retry, which only differ in whether a new user
+	// message is appended first.
+	runTurn := func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		interruptCh := make(chan os.Signal, 1)
+		signal.Notify(interruptCh, os.Interrupt)
+		go func() {
+			if _, ok := <-interruptCh; ok {
+				cancel()
+			}
+		}()
+
+		fmt.Print("AI: ")
+		var aiResponse string
+
+		err := client.StreamChatCompletion(ctx, conversationHistory, model, temperature, func(delta ChatCompletionDelta) error {
+			if delta.Usage != nil {
+				usageTotals.PromptTokens += delta.Usage.PromptTokens
+				usageTotals.CompletionTokens += delta.Usage.CompletionTokens
+				usageTotals.TotalTokens += delta.Usage.TotalTokens
+			}
+			aiResponse += delta.Content
+			fmt.Print(delta.Content)
+			return nil
+		})
+
+		signal.Stop(interruptCh)
+		close(interruptCh)
+		cancel()
+
+		if err != nil && err != context.Canceled {
+			logger.Error("", "interactive shell chat completion failed", map[string]interface{}{"error": err.Error()})
+			fmt.Printf("\nAn error occurred: %s\n", err.Error())
+			return
+		}
+		if err == context.Canceled {
+			fmt.Print("\n[canceled]")
+		}
+		fmt.Println()
+
+		conversationHistory = append(conversationHistory, Message{Role: "assistant", Content: aiResponse})
+
+		if sessionName != "" {
+			if err := saveSession(sessionName, conversationHistory); err != nil {
+				logger.Warn("", "failed to autosave session", map[string]interface{}{"session": sessionName, "error": err.Error()})
+			}
+		}
+	}
+
+	// handleSlashCommand dispatches one of the "/"-prefixed REPL commands,
+	// closing over the same conversationHistory/model/temperature/
+	// usageTotals that plain input and runTurn use.
+	handleSlashCommand := func(cmd string, fields []string) {
+		switch cmd {
+		case "/save":
+			if len(fields) < 2 {
+				fmt.Println("Usage: /save <file>")
+				return
+			}
+			state := replSessionState{Messages: conversationHistory, Model: model, Temperature: temperature}
+			if err := saveReplSession(fields[1], state); err != nil {
+				fmt.Printf("Error saving session: %s\n", err.Error())
+			} else {
+				fmt.Printf("Saved session %q\n", fields[1])
+			}
+		case "/load":
+			if len(fields) < 2 {
+				fmt.Println("Usage: /load <file>")
+				return
+			}
+			state, err := loadReplSession(fields[1])
+			if err != nil {
+				fmt.Printf("Error loading session: %s\n", err.Error())
+				return
+			}
+			conversationHistory = state.Messages
+			model = state.Model
+			temperature = state.Temperature
+			fmt.Printf("Loaded session %q (%d messages)\n", fields[1], len(state.Messages))
+		case "/dump":
+			for i, msg := range conversationHistory {
+				content := msg.Content
+				if len(content) > 60 {
+					content = content[:57] + "..."
+				}
+				fmt.Printf("%3d  %-9s  %s\n", i, msg.Role, content)
+			}
+		case "/system":
+			if len(fields) < 2 {
+				fmt.Println("Usage: /system <prompt>")
+				return
+			}
+			newPrompt := strings.Join(fields[1:], " ")
+			if len(conversationHistory) > 0 && conversationHistory[0].Role == "system" {
+				conversationHistory[0].Content = newPrompt
+			} else {
+				conversationHistory = append([]Message{{Role: "system", Content: newPrompt}}, conversationHistory...)
+			}
+			fmt.Println("System prompt updated")
+		case "/model":
+			if len(fields) < 2 {
+				fmt.Println("Usage: /model <name>")
+				return
+			}
+			model = fields[1]
+			fmt.Printf("Model set to %q\n", model)
+		case "/temp":
+			if len(fields) < 2 {
+				fmt.Println("Usage: /temp <float>")
+				return
+			}
+			t, err := strconv.ParseFloat(fields[1], 64)
+			if err != nil {
+				fmt.Printf("Invalid temperature %q: %s\n", fields[1], err.Error())
+				return
+			}
+			temperature = &t
+			fmt.Printf("Temperature set to %v\n", t)
+		case "/reset":
+			if len(conversationHistory) > 0 && conversationHistory[0].Role == "system" {
+				conversationHistory = conversationHistory[:1]
+			} else {
+				conversationHistory = nil
+			}
+			fmt.Println("Conversation history reset")
+		case "/retry":
+			if len(conversationHistory) > 0 && conversationHistory[len(conversationHistory)-1].Role == "assistant" {
+				conversationHistory = conversationHistory[:len(conversationHistory)-1]
+			}
+			if len(conversationHistory) == 0 || conversationHistory[len(conversationHistory)-1].Role != "user" {
+				fmt.Println("Nothing to retry")
+				return
+			}
+			runTurn()
+		case "/tokens":
+			fmt.Printf("prompt=%d completion=%d total=%d\n", usageTotals.PromptTokens, usageTotals.CompletionTokens, usageTotals.TotalTokens)
+		case "/list":
+			names, err := listReplSessionNames()
+			if err != nil {
+				fmt.Printf("Error listing sessions: %s\n", err.Error())
+				return
+			}
+			if len(names) == 0 {
+				fmt.Println("No saved sessions.")
+			}
+			for _, name := range names {
+				fmt.Println(" ", name)
+			}
+		case "/rename":
+			if len(fields) < 3 {
+				fmt.Println("Usage: /rename <old> <new>")
+				return
+			}
+			if err := renameReplSession(fields[1], fields[2]); err != nil {
+				fmt.Printf("Error renaming session: %s\n", err.Error())
+			} else {
+				fmt.Printf("Renamed session %q to %q\n", fields[1], fields[2])
+			}
+		case "/delete":
+			if len(fields) < 2 {
+				fmt.Println("Usage: /delete <name>")
+				return
+			}
+			if err := deleteReplSession(fields[1]); err != nil {
+				fmt.Printf("Error deleting session: %s\n", err.Error())
+			} else {
+				fmt.Printf("Deleted session %q\n", fields[1])
+			}
+		case "/edit":
+			input, err := editInEditor("")
+			if err != nil {
+				fmt.Printf("Error editing input: %s\n", err.Error())
+				return
+			}
+			input = strings.TrimSpace(input)
+			if input == "" {
+				fmt.Println("Empty input, nothing sent.")
+				return
+			}
+			conversationHistory = append(conversationHistory, Message{Role: "user", Content: input})
+			conversationHistory = summarizeHistory(client, conversationHistory, historyTokenBudget)
+			runTurn()
+		default:
+			fmt.Printf("Unknown command %q. Type 'help' for available commands.\n", cmd)
+		}
+	}
 
 	scanner := bufio.NewScanner(os.Stdin)
 
@@ -391,69 +1116,170 @@ func InteractiveShell(client *LlamafileClient, prompt string) {
 			break
 		}
 		userInput := strings.TrimSpace(scanner.Text())
+		fields := strings.Fields(userInput)
+		cmd := ""
+		if len(fields) > 0 {
+			cmd = strings.ToLower(fields[0])
+		}
 
-		if strings.ToLower(userInput) == "exit" {
+		if strings.HasPrefix(userInput, "/") {
+			handleSlashCommand(cmd, fields)
+			continue
+		}
+
+		switch cmd {
+		case "exit":
 			fmt.Println("Exiting interactive shell.")
-			break
-		} else if strings.ToLower(userInput) == "help" {
+			if sessionName != "" {
+				if err := saveSession(sessionName, conversationHistory); err != nil {
+					fmt.Printf("Warning: failed to save session %q: %s\n", sessionName, err.Error())
+				}
+			}
+			return
+		case "help":
 			printHelp()
 			continue
-		} else if strings.ToLower(userInput) == "clear" {
+		case "clear":
 			conversationHistory = conversationHistory[:1]
 			fmt.Println("Conversation history cleared.")
 			continue
-		}
-
-		conversationHistory = append(conversationHistory, Message{Role: "user", Content: userInput})
-		resp, err := client.ChatCompletion(conversationHistory, true)
-		if err != nil {
-			fmt.Printf("An error occurred: %s\n", err.Error())
+		case "save":
+			if len(fields) < 2 {
+				fmt.Println("Usage: save <name>")
+				continue
+			}
+			sessionName = fields[1]
+			if err := saveSession(sessionName, conversationHistory); err != nil {
+				fmt.Printf("Error saving session: %s\n", err.Error())
+			} else {
+				fmt.Printf("Saved session %q\n", sessionName)
+			}
+			continue
+		case "load":
+			if len(fields) < 2 {
+				fmt.Println("Usage: load <name>")
+				continue
+			}
+			loaded, err := loadSession(fields[1])
+			if err != nil {
+				fmt.Printf("Error loading session: %s\n", err.Error())
+				continue
+			}
+			sessionName = fields[1]
+			conversationHistory = loaded
+			fmt.Printf("Loaded session %q (%d messages)\n", sessionName, len(loaded))
+			continue
+		case "list":
+			names, err := listSessionNames()
+			if err != nil {
+				fmt.Printf("Error listing sessions: %s\n", err.Error())
+				continue
+			}
+			if len(names) == 0 {
+				fmt.Println("No saved sessions.")
+			}
+			for _, name := range names {
+				fmt.Println(" ", name)
+			}
+			continue
+		case "rm":
+			if len(fields) < 2 {
+				fmt.Println("Usage: rm <name>")
+				continue
+			}
+			if err := removeSession(fields[1]); err != nil {
+				fmt.Printf("Error removing session: %s\n", err.Error())
+			} else {
+				fmt.Printf("Removed session %q\n", fields[1])
+			}
 			continue
 		}
 
-		defer resp.Body.Close()
-		reader := bufio.NewReader(resp.Body)
-		fmt.Print("AI: ")
-		var aiResponse string
+		conversationHistory = append(conversationHistory, Message{Role: "user", Content: userInput})
+		conversationHistory = summarizeHistory(client, conversationHistory, historyTokenBudget)
+		runTurn()
+	}
+}
 
-		for {
-			line, err := reader.ReadString('\n')
-			if err != nil {
-				break
-			}
+// runCtlCommand sends verb/args to a running daemon's control socket and
+// prints its response, exiting with status 1 if no daemon answers or the
+// verb fails: the shared implementation
+// behind both "sumarai ctl <verb> [args]" and the older "-ctl <verb>" flag.
+func runCtlCommand(verb string, args []string) {
+	resp, err := ctlClient(verb, args)
+	if err != nil {
+		fmt.Printf("Error: no daemon reachable on the control socket: %s\n", err.Error())
+		os.Exit(1)
+	}
+	if !resp.OK {
+		fmt.Printf("Error: %s\n", resp.Error)
+		os.Exit(1)
+	}
+	fmt.Println(resp.Data)
+}
 
-			if strings.HasPrefix(line, "data: ") {
-				data := strings.TrimPrefix(line, "data: ")
-				if data == "[DONE]\n" {
-					break
-				}
+// editInEditor opens $EDITOR (falling back to vi) on a temp file seeded
+// with initial, waits for it to exit, and returns the file's final
+// contents. It gives /edit a way to compose multi-line input without the
+// line-at-a-time REPL prompt.
+func editInEditor(initial string) (string, error) {
+	f, err := ioutil.TempFile("", "sumarai-edit-*.txt")
+	if err != nil {
+		return "", err
+	}
+	path := f.Name()
+	defer os.Remove(path)
 
-				var response ChatCompletionResponse
-				if err := json.Unmarshal([]byte(data), &response); err != nil {
-					continue
-				}
+	if _, err := f.WriteString(initial); err != nil {
+		f.Close()
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		return "", err
+	}
 
-				for _, choice := range response.Choices {
-					content := choice.Delta.Content
-					cleanedContent := CleanContent(content)
-					aiResponse += cleanedContent
-					fmt.Print(cleanedContent)
-				}
-			}
-		}
+	editor := os.Getenv("EDITOR")
+	if editor == "" {
+		editor = "vi"
+	}
 
-		// Add a newline after the AI's response
-		fmt.Println()
+	cmd := exec.Command(editor, path)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return "", err
+	}
 
-		conversationHistory = append(conversationHistory, Message{Role: "assistant", Content: aiResponse})
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
 	}
+	return string(data), nil
 }
 
 func printHelp() {
 	fmt.Println("Available commands:")
-	fmt.Println("  help    - Show this help message")
-	fmt.Println("  clear   - Clear the conversation history")
-	fmt.Println("  exit    - Exit the interactive shell")
+	fmt.Println("  help             - Show this help message")
+	fmt.Println("  clear            - Clear the conversation history")
+	fmt.Println("  save <name>      - Save the conversation history as a session")
+	fmt.Println("  load <name>      - Load a previously saved session")
+	fmt.Println("  list             - List saved sessions")
+	fmt.Println("  rm <name>        - Delete a saved session")
+	fmt.Println("  /save <file>     - Save history, model, and temperature to ~/.sumarai/sessions/<file>.json")
+	fmt.Println("  /load <file>     - Load a session saved with /save")
+	fmt.Println("  /dump            - Pretty-print the conversation history")
+	fmt.Println("  /system <prompt> - Replace the system message")
+	fmt.Println("  /model <name>    - Set the model name sent with each request")
+	fmt.Println("  /temp <float>    - Set the sampling temperature")
+	fmt.Println("  /reset           - Clear the conversation history")
+	fmt.Println("  /retry           - Drop the last assistant reply and regenerate it")
+	fmt.Println("  /tokens          - Print running prompt/completion/total token usage")
+	fmt.Println("  /list            - List sessions saved with /save")
+	fmt.Println("  /rename <a> <b>  - Rename a saved session")
+	fmt.Println("  /delete <file>   - Delete a saved session")
+	fmt.Println("  /edit            - Open $EDITOR for multi-line input, then send it")
+	fmt.Println("  exit             - Exit the interactive shell")
 }
 
 func main() {
@@ -463,20 +1289,114 @@ func main() {
 	stop := flag.Bool("stop", false, "Stop the running llamafile service")
 	status := flag.Bool("status", false, "Check if the llamafile service is running")
 	llamafile := flag.String("llamafile", "", "Path to the llamafile executable")
+	logLevel := flag.String("log-level", "", "Minimum log level: debug, info, warn, error, fatal (default info, or $LLAMAFILE_LOG_LEVEL)")
+	logFormat := flag.String("log-format", "text", "Log output format: text or json")
+	logFile := flag.String("log-file", "", "Path to a log file (rotated at 10MB, 3 backups kept); empty logs to stderr")
+	stopGrace := flag.Duration("stop-grace", defaultStopGracePeriod, "How long to wait after SIGTERM before sending SIGKILL when stopping llamafile")
+	shutdownTimeout := flag.Duration("shutdown-timeout", 0, "Lame-duck window to drain in-flight chat completions before stopping llamafile; overrides -stop-grace when set")
+	ctlVerb := flag.String("ctl", "", "Equivalent to 'sumarai ctl <verb> [args]': send a verb (status, state, stop, reload, tail <n>, stats, tail-log, chat, set-prompt, list-sessions) to a running daemon's control socket and print its response")
+	rotateKey := flag.Bool("rotate-key", false, "Generate a new API key, persist it, and restart llamafile under it")
+	backendName := flag.String("backend", "", "Inference backend for file summarization: llamafile, llamacpp (or llama-cpp), ollama, or openai (default llamafile, or $SUMARAI_BACKEND); the interactive shell always uses the llamafile client")
+	session := flag.String("session", "", "Name of a persistent chat session to resume (or start) in the interactive shell")
+	tlsCert := flag.String("tls-cert", "", "Path to a TLS certificate for llamafile's HTTPS endpoint (requires -tls-key)")
+	tlsKey := flag.String("tls-key", "", "Path to the TLS certificate's private key (requires -tls-cert)")
+	tlsAuto := flag.String("tls-auto", "", "Hostname to automatically provision and renew a Let's Encrypt certificate for, instead of -tls-cert/-tls-key")
+	remote := flag.String("remote", "", "Run llamafile on user@host[:port] over SSH instead of locally, tunneling the local port to it")
+	upload := flag.Bool("upload", false, "With -remote, upload the local llamafile executable if it is missing on the remote host")
+	var logSinks []LogSink
+	flag.Var(&logSinkFlag{sinks: &logSinks}, "log", "Additional log sink as <kind>=<path>, kind one of human, json, stackdriver (repeatable)")
+	healthAddr := flag.String("health-addr", "", "Address (e.g. :8081) to serve GET /v1/health on, reporting \"draining\" during shutdown; disabled when empty")
+	minRunSeconds := flag.Duration("min-run-seconds", defaultMinRunSeconds, "In -service mode, how long llamafile must stay up for a crash to not count against -max-retries")
+	maxRetries := flag.Int("max-retries", defaultMaxRetries, "In -service mode, how many times in a row llamafile may crash within -min-run-seconds before the supervisor gives up")
+	chunkTokens := flag.Int("chunk-tokens", defaultChunkTokens, "Approximate token budget (bytes/4) per chunk when summarizing files larger than the model's context window")
+	concurrency := flag.Int("concurrency", defaultConcurrency, "Number of chunk summarization requests to run concurrently")
+	format := flag.String("format", "text", "Output format for file summarization: text or json")
+	historyTokens := flag.Int("history-tokens", defaultHistoryTokenBudget, "Approximate token budget for the interactive shell's conversation history before the oldest messages are summarized away")
 
 	flag.Parse()
 	files := flag.Args()
 
-	ConfigureLogging(*debug)
+	ConfigureLogging(*debug, *logLevel, *logFormat, *logFile, logSinks)
+	defer logger.Close()
+
+	if len(files) > 0 && files[0] == "ctl" {
+		if len(files) < 2 {
+			fmt.Println("Usage: sumarai ctl <verb> [args...]")
+			os.Exit(1)
+		}
+		runCtlCommand(files[1], files[2:])
+		return
+	}
+
+	if *ctlVerb != "" {
+		runCtlCommand(*ctlVerb, files)
+		return
+	}
 
 	client, err := NewLlamafileClient(*llamafile, *service || *stop)
 	if err != nil {
+		logger.Error("", "failed to initialize llamafile client", map[string]interface{}{"error": err.Error()})
 		fmt.Printf("Error: %s\n", err.Error())
 		os.Exit(1)
 	}
+	client.stopGracePeriod = *stopGrace
+	if *shutdownTimeout > 0 {
+		client.stopGracePeriod = *shutdownTimeout
+	}
+	client.minRunSeconds = *minRunSeconds
+	client.maxRetries = *maxRetries
+
+	if *tlsCert != "" || *tlsKey != "" || *tlsAuto != "" {
+		if err := client.configureTLS(*tlsCert, *tlsKey, *tlsAuto); err != nil {
+			logger.Error("", "failed to configure TLS", map[string]interface{}{"error": err.Error()})
+			fmt.Printf("Error: %s\n", err.Error())
+			os.Exit(1)
+		}
+	}
+
+	if *remote != "" {
+		if err := client.configureRemote(*remote, *upload); err != nil {
+			logger.Error("", "failed to configure remote llamafile execution", map[string]interface{}{"error": err.Error()})
+			fmt.Printf("Error: %s\n", err.Error())
+			os.Exit(1)
+		}
+	}
+
+	if *healthAddr != "" {
+		go func() {
+			if err := client.serveHealth(*healthAddr); err != nil {
+				logger.Warn("", "health endpoint stopped", map[string]interface{}{"error": err.Error()})
+			}
+		}()
+	}
+
+	if *rotateKey {
+		wasRunning := false
+		if resp, err := ctlClient("status", nil); err == nil && resp.OK {
+			wasRunning = true
+			if err := client.StopLlamafile(); err != nil {
+				fmt.Printf("Error stopping llamafile for key rotation: %s\n", err.Error())
+				os.Exit(1)
+			}
+		}
+		if err := client.rotateAPIKey(); err != nil {
+			fmt.Printf("Error rotating API key: %s\n", err.Error())
+			os.Exit(1)
+		}
+		fmt.Println("API key rotated")
+		if wasRunning {
+			if err := client.StartLlamafile(true); err != nil {
+				fmt.Printf("Error restarting llamafile under new key: %s\n", err.Error())
+				os.Exit(1)
+			}
+			fmt.Println("Llamafile restarted under new API key")
+		}
+		return
+	}
 
 	if *stop {
 		if err := client.StopLlamafile(); err != nil {
+			logger.Error("", "failed to stop llamafile", map[string]interface{}{"error": err.Error()})
 			fmt.Printf("Error stopping llamafile: %s\n", err.Error())
 			os.Exit(1)
 		}
@@ -523,43 +1443,39 @@ func main() {
 	}
 
 	if len(files) == 0 {
-		InteractiveShell(client, *prompt)
+		InteractiveShell(client, *prompt, *session, *historyTokens)
 	} else {
+		backend, err := selectBackend(*backendName, client)
+		if err != nil {
+			logger.Error("", "failed to select backend", map[string]interface{}{"error": err.Error()})
+			fmt.Printf("Error: %s\n", err.Error())
+			os.Exit(1)
+		}
+
+		summarizer := NewSummarizer(backend, *prompt, *chunkTokens, *concurrency)
+
 		for _, file := range files {
 			content, err := ioutil.ReadFile(file)
 			if err != nil {
 				fmt.Printf("Error reading file %s: %s\n", file, err.Error())
 				continue
 			}
-			messageContent := fmt.Sprintf("%s\n\n%s", *prompt, string(content))
-			messages := []Message{
-				{Role: "user", Content: messageContent},
-			}
-			resp, err := client.ChatCompletion(messages, false)
-			if err != nil {
-				fmt.Printf("An error occurred: %s\n", err.Error())
-				continue
-			}
-			defer resp.Body.Close()
-			bodyBytes, err := ioutil.ReadAll(resp.Body)
+
+			result, err := summarizer.Summarize(context.Background(), file, string(content))
 			if err != nil {
 				fmt.Printf("An error occurred: %s\n", err.Error())
 				continue
 			}
-			var response map[string]interface{}
-			if err := json.Unmarshal(bodyBytes, &response); err != nil {
-				fmt.Printf("Error parsing response: %s\n", err.Error())
-				continue
-			}
-			choices, ok := response["choices"].([]interface{})
-			if ok && len(choices) > 0 {
-				choice := choices[0].(map[string]interface{})
-				message, ok := choice["message"].(map[string]interface{})
-				if ok {
-					content, _ := message["content"].(string)
-					cleanedContent := CleanContent(content)
-					fmt.Println(cleanedContent)
+
+			if *format == "json" {
+				out, err := marshalSummaryJSON(result)
+				if err != nil {
+					fmt.Printf("An error occurred: %s\n", err.Error())
+					continue
 				}
+				fmt.Println(out)
+			} else {
+				fmt.Println(result.Final)
 			}
 		}
 	}
@@ -3,12 +3,14 @@ package main
 import (
 	"fmt"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 )
 
 var (
@@ -28,7 +30,7 @@ func TestFindExecutable(t *testing.T) {
 	// Test case 1: Executable not found
 	os.Setenv("PATH", "/test/path")
 	os.Setenv("LLAMAFILE", "")
-	_, err := findExecutable()
+	_, err := findExecutable("")
 	if err == nil {
 		t.Error("Expected error when executable not found, got nil")
 	}
@@ -36,11 +38,10 @@ func TestFindExecutable(t *testing.T) {
 	// Test case 2: Executable in current directory
 	currentDir, _ := os.Getwd()
 	dummyFile := filepath.Join(currentDir, "llamafile")
-	os.Create(dummyFile)
+	os.WriteFile(dummyFile, []byte("#!/bin/sh\n"), 0755)
 	defer os.Remove(dummyFile)
 
-	fmt.Printf("Debug: Current Directory=%s, LLAMAFILE=%s\n", currentDir, os.Getenv("LLAMAFILE"))
-	path, err := findExecutable()
+	path, err := findExecutable("")
 	if err != nil {
 		t.Errorf("Unexpected error: %v", err)
 	}
@@ -51,31 +52,45 @@ func TestFindExecutable(t *testing.T) {
 	// Test case 3: Executable in LLAMAFILE env var
 	customPath := filepath.Join(currentDir, "llamafile")
 	os.Setenv("LLAMAFILE", customPath)
-	fmt.Printf("Debug: Custom Path=%s, Exists=%t\n", customPath, exists(customPath))
-	path, err = findExecutable()
+	path, err = findExecutable("")
 	if err != nil {
 		t.Errorf("Unexpected error: %v", err)
 	}
 	if path != customPath {
 		t.Errorf("Expected %s, got %s", customPath, path)
 	}
-}
 
-func exists(filePath string) bool {
-	info, err := os.Stat(filePath)
-	return err == nil && !info.IsDir()
+	// Test case 4: explicit executablePath argument takes precedence
+	path, err = findExecutable(customPath)
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if path != customPath {
+		t.Errorf("Expected %s, got %s", customPath, path)
+	}
 }
 
 func TestGenerateAPIKey(t *testing.T) {
 	key1 := generateAPIKey()
 	key2 := generateAPIKey()
 
-	if len(key1) != 32 {
-		t.Errorf("Expected API key length of 32, got %d", len(key1))
+	if len(key1) != 64 {
+		t.Errorf("Expected API key length of 64, got %d", len(key1))
 	}
 	if key1 == key2 {
 		t.Error("Generated API keys should be unique")
 	}
+
+	// Keys generated back-to-back must still differ even if the system
+	// clock has low resolution, since they no longer derive from time.
+	keys := make(map[string]bool, 100)
+	for i := 0; i < 100; i++ {
+		k := generateAPIKey()
+		if keys[k] {
+			t.Fatalf("Generated a duplicate API key: %s", k)
+		}
+		keys[k] = true
+	}
 }
 
 func TestNewLlamafileClient(t *testing.T) {
@@ -91,42 +106,35 @@ func TestNewLlamafileClient(t *testing.T) {
 		t.Fatalf("Failed to create temp executable: %v", err)
 	}
 
-	// Set the LLAMAFILE environment variable to the temp executable
-	os.Setenv("LLAMAFILE", tempExecutable)
-	defer os.Unsetenv("LLAMAFILE")
-
-	client, err := NewLlamafileClient("", "", "localhost", 8080)
+	client, err := NewLlamafileClient(tempExecutable, false)
 	if err != nil {
 		t.Fatalf("Unexpected error: %v", err)
 	}
 
-	fmt.Printf("Debug: LLAMAFILE=%s, ExecutablePath=%s, Exists=%t\n", os.Getenv("LLAMAFILE"), client.ExecutablePath, exists(client.ExecutablePath))
-
-	if client == nil {
-		t.Fatal("Expected non-nil client")
-	}
-
-	if client.Host != "localhost" {
-		t.Errorf("Expected host to be localhost, got %s", client.Host)
+	if client.host != defaultHost {
+		t.Errorf("Expected host to be %s, got %s", defaultHost, client.host)
 	}
-	if client.Port != 8080 {
-		t.Errorf("Expected port to be 8080, got %d", client.Port)
+	if client.port != defaultPort {
+		t.Errorf("Expected port to be %d, got %d", defaultPort, client.port)
 	}
-	if client.APIKey == "" {
+	if client.apiKey == "" {
 		t.Error("API key should not be empty")
 	}
-	if client.ExecutablePath != tempExecutable {
-		t.Errorf("Expected ExecutablePath to be %s, got %s", tempExecutable, client.ExecutablePath)
+	if client.executablePath != tempExecutable {
+		t.Errorf("Expected executablePath to be %s, got %s", tempExecutable, client.executablePath)
+	}
+	if client.serviceMode {
+		t.Error("Expected serviceMode to be false")
 	}
 }
 
 func TestConfigureLogging(t *testing.T) {
-	configureLogging(true)
+	ConfigureLogging(true, "", "text", "", nil)
 	if logger == nil {
 		t.Error("Logger should not be nil when debug is enabled")
 	}
 
-	configureLogging(false)
+	ConfigureLogging(false, "", "text", "", nil)
 	if logger == nil {
 		t.Error("Logger should not be nil when debug is disabled")
 	}
@@ -135,10 +143,10 @@ func TestConfigureLogging(t *testing.T) {
 func TestStartLlamafile(t *testing.T) {
 	// Mock LlamafileClient for testing
 	client := &LlamafileClient{
-		ExecutablePath: "/path/to/mock",
-		APIKey:         "mockapikey",
-		Host:           "localhost",
-		Port:           8080,
+		executablePath: "/path/to/mock",
+		apiKey:         "mockapikey",
+		host:           "localhost",
+		port:           8080,
 	}
 
 	// Mock exec.Command to prevent starting a real process
@@ -157,6 +165,29 @@ func TestStartLlamafile(t *testing.T) {
 	}
 }
 
+func TestWaitForServer(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to open test listener: %v", err)
+	}
+	defer listener.Close()
+
+	addr := listener.Addr().(*net.TCPAddr)
+	client := &LlamafileClient{host: "127.0.0.1", port: addr.Port}
+	if err := client.waitForServerWithin(500*time.Millisecond, 20*time.Millisecond); err != nil {
+		t.Errorf("expected waitForServerWithin to succeed once the port is listening, got: %v", err)
+	}
+}
+
+func TestWaitForServerTimesOut(t *testing.T) {
+	// Nothing listens on this port, so waitForServerWithin must time out
+	// rather than block indefinitely.
+	client := &LlamafileClient{host: "127.0.0.1", port: 1}
+	if err := client.waitForServerWithin(50*time.Millisecond, 10*time.Millisecond); err == nil {
+		t.Error("expected waitForServerWithin to time out when nothing is listening")
+	}
+}
+
 func TestCheckServerStatus(t *testing.T) {
 	// Mock http.Get to control the response
 	oldHttpGet := httpGet
@@ -171,16 +202,16 @@ func TestCheckServerStatus(t *testing.T) {
 	}
 	defer func() { httpGet = oldHttpGet }()
 
-	checkServerStatus() // Expect "running"
+	CheckServerStatus() // Falls back to a raw TCP probe when no ctl socket answers.
 }
 
 func TestInteractiveShell(t *testing.T) {
 	// Mock LlamafileClient for testing
 	client := &LlamafileClient{
-		ExecutablePath: "/path/to/mock",
-		APIKey:         "mockapikey",
-		Host:           "localhost",
-		Port:           8080,
+		executablePath: "/path/to/mock",
+		apiKey:         "mockapikey",
+		host:           "localhost",
+		port:           8080,
 	}
 
 	// Mock user input for testing
@@ -192,44 +223,6 @@ func TestInteractiveShell(t *testing.T) {
 	w.WriteString(mockInput)
 	w.Close()
 
-	oldStdout := os.Stdout
-	oldStderr := os.Stderr
-	defer func() {
-		os.Stdout = oldStdout
-		os.Stderr = oldStderr
-	}()
 	// Ensure it triggers expected functions without errors
-	interactiveShell(client)
-}
-
-func TestMainFunction(t *testing.T) {
-	// Ensure LLAMAFILE environment variable is accurately set
-	llamafilePath := filepath.Join("..", "golang", "llamafile")
-	os.Setenv("LLAMAFILE", llamafilePath)
-
-	// Print the absolute path for verification
-	absPath, err := filepath.Abs(llamafilePath)
-	if err != nil {
-		t.Fatalf("Failed to get absolute path: %v", err)
-	}
-	fmt.Printf("LLAMAFILE environment set to: %s (absolute path: %s)\n", llamafilePath, absPath)
-
-	// Manually verify the existence of the file
-	_, err = os.Stat(llamafilePath)
-	if os.IsNotExist(err) {
-		t.Fatalf("LLAMAFILE executable not found at %s", llamafilePath)
-	}
-
-	// Save and restore the original arguments
-	origArgs := os.Args
-	defer func() { os.Args = origArgs }()
-	defer os.Unsetenv("LLAMAFILE")
-
-	// Check server status as a test
-	os.Args = []string{"sumarai", "--status"}
-	main() // Expect checkServerStatus to run correctly
-
-	// Stop Llamafile as a test
-	os.Args = []string{"sumarai", "--stop"}
-	main() // Expect StopLlamafile to execute without error
+	InteractiveShell(client, "", "", 0)
 }
@@ -0,0 +1,274 @@
+// summarize.go
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+const (
+	// charsPerToken is the bytes/4 heuristic used to turn a token budget
+	// into a byte budget without pulling in a real tokenizer.
+	charsPerToken = 4
+
+	defaultChunkTokens = 2000
+	defaultConcurrency = 3
+)
+
+// ChunkSummary is one chunk's byte range (in its source text) and the
+// summary the model produced for it.
+type ChunkSummary struct {
+	Range   string `json:"range"`
+	Summary string `json:"summary"`
+}
+
+// SummarizerResult is a file's full summarization output: each chunk's
+// individual summary plus the reduced final summary, suitable for
+// --format json.
+type SummarizerResult struct {
+	File   string         `json:"file"`
+	Chunks []ChunkSummary `json:"chunks"`
+	Final  string         `json:"final"`
+}
+
+// Summarizer turns a large document into a summary by splitting it into
+// token-approximate chunks, summarizing each chunk concurrently through a
+// Backend, and reducing the chunk summaries into a single synthesis. This
+// lets sumarai handle input far larger than the model's context window,
+// instead of prepending the whole file to one prompt.
+type Summarizer struct {
+	backend     Backend
+	prompt      string
+	chunkTokens int
+	concurrency int
+}
+
+// NewSummarizer builds a Summarizer. chunkTokens and concurrency fall back
+// to defaultChunkTokens/defaultConcurrency when <= 0.
+func NewSummarizer(backend Backend, prompt string, chunkTokens, concurrency int) *Summarizer {
+	if chunkTokens <= 0 {
+		chunkTokens = defaultChunkTokens
+	}
+	if concurrency <= 0 {
+		concurrency = defaultConcurrency
+	}
+	return &Summarizer{backend: backend, prompt: prompt, chunkTokens: chunkTokens, concurrency: concurrency}
+}
+
+// Summarize splits content into chunks, summarizes them with a bounded pool
+// of concurrent backend calls, and reduces the results into a final
+// summary. Progress is streamed to stderr as each chunk completes.
+func (s *Summarizer) Summarize(ctx context.Context, file string, content string) (SummarizerResult, error) {
+	chunks := splitIntoChunks(content, s.chunkTokens)
+
+	summaries := make([]ChunkSummary, len(chunks))
+	sem := make(chan struct{}, s.concurrency)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var firstErr error
+
+	for i, chunk := range chunks {
+		i, chunk := i, chunk
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			summary, err := s.summarizeOne(ctx, chunk.text)
+			if err != nil {
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				mu.Unlock()
+				return
+			}
+
+			mu.Lock()
+			summaries[i] = ChunkSummary{Range: chunk.rangeLabel(), Summary: summary}
+			mu.Unlock()
+			fmt.Fprintf(os.Stderr, "%s: chunk %d/%d (%s) summarized\n", file, i+1, len(chunks), chunk.rangeLabel())
+		}()
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return SummarizerResult{}, firstErr
+	}
+
+	if len(summaries) == 1 {
+		return SummarizerResult{File: file, Chunks: summaries, Final: summaries[0].Summary}, nil
+	}
+
+	final, err := s.reduce(ctx, summaries)
+	if err != nil {
+		return SummarizerResult{}, err
+	}
+	return SummarizerResult{File: file, Chunks: summaries, Final: final}, nil
+}
+
+// summarizeOne asks the backend to summarize a single chunk of text.
+func (s *Summarizer) summarizeOne(ctx context.Context, text string) (string, error) {
+	messages := []Message{{Role: "user", Content: fmt.Sprintf("%s\n\n%s", s.prompt, text)}}
+	return collectChat(ctx, s.backend, messages)
+}
+
+// reduce concatenates chunk summaries and asks the model for a final
+// synthesis, recursing (re-chunking the concatenated summaries) if the
+// concatenation itself exceeds the chunk window.
+func (s *Summarizer) reduce(ctx context.Context, summaries []ChunkSummary) (string, error) {
+	var combined strings.Builder
+	for _, cs := range summaries {
+		combined.WriteString(cs.Summary)
+		combined.WriteString("\n\n")
+	}
+
+	if approxTokens(combined.String()) <= s.chunkTokens {
+		messages := []Message{{Role: "user", Content: fmt.Sprintf(
+			"Synthesize the following section summaries into a single coherent summary:\n\n%s", combined.String())}}
+		return collectChat(ctx, s.backend, messages)
+	}
+
+	fmt.Fprintf(os.Stderr, "reducing %d section summaries exceeds the chunk window; re-chunking\n", len(summaries))
+
+	subChunks := splitIntoChunks(combined.String(), s.chunkTokens)
+	subSummaries := make([]ChunkSummary, len(subChunks))
+	for i, c := range subChunks {
+		summary, err := s.summarizeOne(ctx, c.text)
+		if err != nil {
+			return "", err
+		}
+		subSummaries[i] = ChunkSummary{Range: c.rangeLabel(), Summary: summary}
+	}
+	return s.reduce(ctx, subSummaries)
+}
+
+// approxTokens estimates a token count from a string's byte length using
+// the bytes/4 heuristic.
+func approxTokens(s string) int {
+	return (len(s) + charsPerToken - 1) / charsPerToken
+}
+
+// textChunk is a contiguous slice of a source text along with the byte
+// offsets it came from, used to label chunks in SummarizerResult.
+type textChunk struct {
+	text      string
+	startByte int
+	endByte   int
+}
+
+func (c textChunk) rangeLabel() string {
+	return fmt.Sprintf("%d-%d", c.startByte, c.endByte)
+}
+
+var (
+	paragraphBoundary = regexp.MustCompile(`\n\s*\n`)
+	sentenceBoundary  = regexp.MustCompile(`[.!?]\s+`)
+)
+
+// splitIntoChunks breaks content into chunks of at most chunkTokens
+// (bytes/4 heuristic), preferring to break on paragraph boundaries and
+// falling back to sentence boundaries for any paragraph that alone
+// exceeds the budget.
+func splitIntoChunks(content string, chunkTokens int) []textChunk {
+	if chunkTokens <= 0 {
+		chunkTokens = defaultChunkTokens
+	}
+	maxBytes := chunkTokens * charsPerToken
+
+	chunks := packUnits(splitParagraphs(content), maxBytes)
+	if len(chunks) == 0 {
+		return []textChunk{{text: content, startByte: 0, endByte: len(content)}}
+	}
+	return chunks
+}
+
+// splitParagraphs splits content on blank-line boundaries, preserving the
+// exact byte offsets of each paragraph in content.
+func splitParagraphs(content string) []textChunk {
+	var units []textChunk
+	start := 0
+	for _, loc := range paragraphBoundary.FindAllStringIndex(content, -1) {
+		if loc[0] > start {
+			units = append(units, textChunk{text: content[start:loc[0]], startByte: start, endByte: loc[0]})
+		}
+		start = loc[1]
+	}
+	if start < len(content) {
+		units = append(units, textChunk{text: content[start:], startByte: start, endByte: len(content)})
+	}
+	return units
+}
+
+// splitSentences splits text on sentence-ending punctuation, offsetting
+// the resulting byte ranges by base (text's position within the original
+// content) so callers see offsets relative to the original document.
+func splitSentences(text string, base int) []textChunk {
+	var units []textChunk
+	start := 0
+	for _, loc := range sentenceBoundary.FindAllStringIndex(text, -1) {
+		units = append(units, textChunk{text: text[start:loc[1]], startByte: base + start, endByte: base + loc[1]})
+		start = loc[1]
+	}
+	if start < len(text) {
+		units = append(units, textChunk{text: text[start:], startByte: base + start, endByte: base + len(text)})
+	}
+	return units
+}
+
+// packUnits greedily packs paragraph-sized units into chunks no larger
+// than maxBytes, splitting any oversized paragraph into sentences first.
+func packUnits(units []textChunk, maxBytes int) []textChunk {
+	var chunks []textChunk
+	var cur strings.Builder
+	curStart, curEnd := -1, 0
+
+	flush := func() {
+		if curStart < 0 {
+			return
+		}
+		chunks = append(chunks, textChunk{text: strings.TrimSpace(cur.String()), startByte: curStart, endByte: curEnd})
+		cur.Reset()
+		curStart = -1
+	}
+	add := func(u textChunk) {
+		if curStart >= 0 && cur.Len()+len(u.text) > maxBytes {
+			flush()
+		}
+		if curStart < 0 {
+			curStart = u.startByte
+		}
+		cur.WriteString(u.text)
+		cur.WriteString("\n\n")
+		curEnd = u.endByte
+	}
+
+	for _, u := range units {
+		if len(u.text) <= maxBytes {
+			add(u)
+			continue
+		}
+		// This single paragraph alone exceeds the budget: break it into
+		// sentences and pack those instead.
+		for _, s := range splitSentences(u.text, u.startByte) {
+			add(s)
+		}
+	}
+	flush()
+	return chunks
+}
+
+// marshalSummaryJSON renders a SummarizerResult as indented JSON for
+// --format json.
+func marshalSummaryJSON(result SummarizerResult) (string, error) {
+	data, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSplitIntoChunksRespectsParagraphBoundaries(t *testing.T) {
+	content := strings.Repeat("a", 40) + "\n\n" + strings.Repeat("b", 40) + "\n\n" + strings.Repeat("c", 40)
+
+	chunks := splitIntoChunks(content, 25) // 25 tokens * 4 bytes/token = 100 byte budget
+	if len(chunks) != 2 {
+		t.Fatalf("expected 2 chunks, got %d: %+v", len(chunks), chunks)
+	}
+	if !strings.Contains(chunks[0].text, strings.Repeat("a", 40)) || !strings.Contains(chunks[0].text, strings.Repeat("b", 40)) {
+		t.Errorf("expected first chunk to pack both small paragraphs, got %q", chunks[0].text)
+	}
+	if !strings.Contains(chunks[1].text, strings.Repeat("c", 40)) {
+		t.Errorf("expected second chunk to hold the final paragraph, got %q", chunks[1].text)
+	}
+}
+
+func TestSplitIntoChunksFallsBackToSentencesForOversizedParagraph(t *testing.T) {
+	sentence := strings.Repeat("x", 30) + ". "
+	paragraph := strings.Repeat(sentence, 10) // one paragraph, no blank lines, well over budget
+
+	chunks := splitIntoChunks(paragraph, 15) // 60 byte budget
+	if len(chunks) < 2 {
+		t.Fatalf("expected an oversized paragraph to be split into multiple chunks, got %d", len(chunks))
+	}
+	for _, c := range chunks {
+		if len(c.text) > 60+len(sentence) {
+			t.Errorf("chunk exceeds budget by more than one sentence: %d bytes", len(c.text))
+		}
+	}
+}
+
+func TestApproxTokens(t *testing.T) {
+	if got := approxTokens("12345678"); got != 2 {
+		t.Errorf("approxTokens(8 bytes) = %d, want 2", got)
+	}
+	if got := approxTokens(""); got != 0 {
+		t.Errorf("approxTokens(\"\") = %d, want 0", got)
+	}
+}
@@ -0,0 +1,121 @@
+// tls.go
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// configureTLS wires certFile/keyFile (static certificate) or autoHost
+// (automatic Let's Encrypt provisioning via ACME) into client, switching
+// its own HTTP client and the llamafile command line it builds over to
+// HTTPS. At most one of (certFile, keyFile) or autoHost should be set.
+func (client *LlamafileClient) configureTLS(certFile, keyFile, autoHost string) error {
+	switch {
+	case autoHost != "":
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return err
+		}
+		certDir := filepath.Join(homeDir, ".sumarai", "certs")
+
+		cert, key, err := obtainAutocertFiles(autoHost, certDir)
+		if err != nil {
+			return fmt.Errorf("tls: failed to provision certificate for %s: %w", autoHost, err)
+		}
+		certFile, keyFile = cert, key
+
+	case certFile != "" && keyFile != "":
+		// Static certificate supplied directly; nothing to provision.
+
+	case certFile != "" || keyFile != "":
+		return fmt.Errorf("tls: both -tls-cert and -tls-key must be set together")
+
+	default:
+		return nil // TLS not requested
+	}
+
+	client.tlsCertFile = certFile
+	client.tlsKeyFile = keyFile
+	client.scheme = "https"
+	logger.Info("", "TLS enabled for llamafile front-end", map[string]interface{}{"cert": certFile})
+	return nil
+}
+
+// obtainAutocertFiles provisions (or renews, via autocert's on-disk cache)
+// a certificate for hostname using the ACME http-01 challenge, briefly
+// serving the challenge handler on :80, then splits the cached combined
+// PEM blob into separate cert/key files under cacheDir because llamafile
+// (like most llama.cpp-derived servers) takes --ssl-cert-file and
+// --ssl-key-file as distinct paths rather than a single PEM bundle.
+func obtainAutocertFiles(hostname, cacheDir string) (certPath, keyPath string, err error) {
+	if err := os.MkdirAll(cacheDir, 0700); err != nil {
+		return "", "", err
+	}
+
+	manager := &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: autocert.HostWhitelist(hostname),
+		Cache:      autocert.DirCache(cacheDir),
+	}
+
+	challengeServer := &http.Server{
+		Addr:    ":80",
+		Handler: manager.HTTPHandler(nil),
+	}
+	go challengeServer.ListenAndServe()
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		challengeServer.Shutdown(ctx)
+	}()
+
+	cert, err := manager.GetCertificate(&tls.ClientHelloInfo{ServerName: hostname})
+	if err != nil {
+		return "", "", err
+	}
+
+	certPath = filepath.Join(cacheDir, hostname+".crt.pem")
+	keyPath = filepath.Join(cacheDir, hostname+".key.pem")
+
+	certFile, err := os.OpenFile(certPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return "", "", err
+	}
+	defer certFile.Close()
+	for _, der := range cert.Certificate {
+		if err := pem.Encode(certFile, &pem.Block{Type: "CERTIFICATE", Bytes: der}); err != nil {
+			return "", "", err
+		}
+	}
+
+	keyBytes, err := marshalPrivateKey(cert.PrivateKey)
+	if err != nil {
+		return "", "", err
+	}
+	if err := os.WriteFile(keyPath, keyBytes, 0600); err != nil {
+		return "", "", err
+	}
+
+	return certPath, keyPath, nil
+}
+
+// marshalPrivateKey PEM-encodes a certificate's private key regardless of
+// its concrete type (autocert issues ECDSA keys by default, but this
+// accepts anything x509.MarshalPKCS8PrivateKey supports).
+func marshalPrivateKey(key interface{}) ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
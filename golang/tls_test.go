@@ -0,0 +1,86 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestConfigureTLSNoOptions(t *testing.T) {
+	client := &LlamafileClient{}
+	if err := client.configureTLS("", "", ""); err != nil {
+		t.Fatalf("configureTLS with no options returned error: %v", err)
+	}
+	if client.scheme != "" {
+		t.Errorf("expected scheme to be left untouched, got %q", client.scheme)
+	}
+}
+
+func TestConfigureTLSRequiresBothCertAndKey(t *testing.T) {
+	client := &LlamafileClient{}
+	if err := client.configureTLS("cert.pem", "", ""); err == nil {
+		t.Error("expected configureTLS to reject -tls-cert without -tls-key")
+	}
+	if err := client.configureTLS("", "key.pem", ""); err == nil {
+		t.Error("expected configureTLS to reject -tls-key without -tls-cert")
+	}
+}
+
+func TestConfigureTLSStaticCert(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, []byte("dummy cert"), 0600); err != nil {
+		t.Fatalf("failed to write dummy cert: %v", err)
+	}
+	if err := os.WriteFile(keyFile, []byte("dummy key"), 0600); err != nil {
+		t.Fatalf("failed to write dummy key: %v", err)
+	}
+
+	client := &LlamafileClient{}
+	if err := client.configureTLS(certFile, keyFile, ""); err != nil {
+		t.Fatalf("configureTLS returned error: %v", err)
+	}
+	if client.scheme != "https" {
+		t.Errorf("expected scheme to switch to https, got %q", client.scheme)
+	}
+	if client.tlsCertFile != certFile || client.tlsKeyFile != keyFile {
+		t.Errorf("expected tlsCertFile/tlsKeyFile to be set to %s/%s, got %s/%s", certFile, keyFile, client.tlsCertFile, client.tlsKeyFile)
+	}
+}
+
+// TestChatCompletionOverTLS exercises the https scheme path end to end
+// against a real TLS listener, which configureTLS switches ChatCompletion
+// over to. The stub server's self-signed certificate is only trusted by
+// its own client, so http.DefaultTransport (what ChatCompletion's plain
+// &http.Client{} uses) is swapped out for the duration of the test.
+func TestChatCompletionOverTLS(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"ok"}}]}`))
+	}))
+	defer server.Close()
+
+	origTransport := http.DefaultTransport
+	http.DefaultTransport = server.Client().Transport
+	defer func() { http.DefaultTransport = origTransport }()
+
+	addr, err := net.ResolveTCPAddr("tcp", server.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("failed to resolve test server address: %v", err)
+	}
+	client := &LlamafileClient{host: addr.IP.String(), port: addr.Port, scheme: "https"}
+
+	resp, err := client.ChatCompletion([]Message{{Role: "user", Content: "hi"}}, false)
+	if err != nil {
+		t.Fatalf("ChatCompletion over TLS returned error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.Request.URL.Scheme != "https" {
+		t.Errorf("expected ChatCompletion to request over https, got %q", resp.Request.URL.Scheme)
+	}
+}